@@ -0,0 +1,52 @@
+// instruments loads the Kite instruments dump into the instruments table
+package main
+
+import (
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+
+	"github.com/nsvirk/moneybotstds/internal/config"
+	"github.com/nsvirk/moneybotstds/internal/logger"
+	"github.com/nsvirk/moneybotstds/internal/repository"
+	"github.com/nsvirk/moneybotstds/internal/service"
+)
+
+func main() {
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// Configure logging, to stdout only
+	if err := logger.Configure(cfg.LogLevel, cfg.LogFormat, os.Stdout); err != nil {
+		log.Fatalf("Failed to configure logging: %v", err)
+	}
+	slog.SetDefault(logger.Stdout())
+
+	source := flag.String("source", cfg.InstrumentsSource, "instruments CSV file path or URL")
+	flag.Parse()
+
+	// Initialize database connection
+	db, err := repository.InitDB(cfg)
+	if err != nil {
+		logger.Fatal(slog.Default(), "Failed to initialize database", "error", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		logger.Fatal(slog.Default(), "Failed to get database instance", "error", err)
+	}
+	defer sqlDB.Close()
+
+	// Load instruments
+	instrumentService := service.NewInstrumentService(db, *source, nil)
+	load, err := instrumentService.Refresh()
+	if err != nil {
+		sqlDB.Close()
+		logger.Fatal(slog.Default(), "Failed to load instruments", "error", err)
+	}
+
+	slog.Info("Instruments loaded", "instruments", load.InstrumentsCt, "source", load.Source, "pruned", load.PrunedCt)
+}
@@ -2,8 +2,8 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -14,9 +14,12 @@ import (
 
 	"github.com/nsvirk/moneybotstds/internal/api"
 	"github.com/nsvirk/moneybotstds/internal/config"
+	"github.com/nsvirk/moneybotstds/internal/kite"
 	"github.com/nsvirk/moneybotstds/internal/logger"
 	"github.com/nsvirk/moneybotstds/internal/repository"
+	"github.com/nsvirk/moneybotstds/internal/secrets"
 	"github.com/nsvirk/moneybotstds/internal/service"
+	"github.com/nsvirk/moneybotstds/internal/tracing"
 )
 
 func main() {
@@ -26,45 +29,164 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// Configure logging, to stdout only until the database is connected
+	if err := logger.Configure(cfg.LogLevel, cfg.LogFormat, os.Stdout); err != nil {
+		log.Fatalf("Failed to configure logging: %v", err)
+	}
+	slog.SetDefault(logger.Stdout())
+
+	// Initialize tracing, spans are flushed on shutdown
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg)
+	if err != nil {
+		logger.Fatal(slog.Default(), "Failed to initialize tracing", "error", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("Failed to flush traces", "error", err)
+		}
+	}()
+
 	// Initialize database connection
 	db, err := repository.InitDB(cfg)
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		logger.Fatal(slog.Default(), "Failed to initialize database", "error", err)
 	}
 	sqlDB, err := db.DB()
 	if err != nil {
-		log.Fatalf("Failed to get database instance: %v", err)
+		logger.Fatal(slog.Default(), "Failed to get database instance", "error", err)
 	}
 	defer sqlDB.Close()
 
 	// Initialize Redis client
 	redisClient, err := repository.NewRedisClient(cfg)
 	if err != nil {
-		log.Fatalf("Failed to initialize Redis: %v", err)
+		logger.Fatal(slog.Default(), "Failed to initialize Redis", "error", err)
 	}
 	defer redisClient.Close()
 
-	// Initialize logger
+	// Initialize logger, rows are written in batches and flushed on shutdown
+	logger.StartBatching(db, logger.BatchConfig{
+		BufferSize:    cfg.LogBufferSize,
+		BatchSize:     cfg.LogBatchSize,
+		FlushInterval: cfg.LogFlushInterval,
+	})
+	defer logger.Close()
+	slog.SetDefault(logger.New(db))
 	appLogger := logger.NewAppLogger(db)
 	appLogger.Info("App initialized")
 
+	// Initialize instrument cache
+	instrumentCache := service.NewInstrumentCache(db)
+	if err := instrumentCache.Load(); err != nil {
+		appLogger.Error("Failed to load instrument cache", "error", err)
+	}
+	appLogger.Info("Instrument cache loaded", "instruments", instrumentCache.Stats().Instruments)
+
+	// Initialize keyring for stored enctokens
+	var keyring *secrets.Keyring
+	if cfg.CredentialsKeys != "" {
+		keyring, err = secrets.NewKeyring(cfg.CredentialsKeys)
+		if err != nil {
+			logger.Fatal(slog.Default(), "Failed to initialize credentials keyring", "error", err)
+		}
+	} else {
+		appLogger.Warn("MB_TDS_CREDENTIALS_KEYS is not set, enctokens are not stored and tickers are not resumed")
+	}
+
+	// Initialize enctoken verifier, shared by the auth middleware and the
+	// ticker service to detect expired sessions
+	enctokenVerifier := kite.NewEnctokenVerifier(cfg)
+
+	// Initialize webhook service
+	webhookService := service.NewWebhookService(db)
+	defer webhookService.Close()
+
+	// Initialize quota service
+	quotaService := service.NewQuotaService(cfg, db)
+
+	// Initialize the exchange calendar, importing the holidays file
+	calendarService, err := service.NewCalendarService(cfg, db)
+	if err != nil {
+		logger.Fatal(slog.Default(), "Failed to initialize exchange calendar", "error", err)
+	}
+
 	// Initialize ticker service
-	tickerService := service.NewTickerService(db, redisClient)
+	tickerService := service.NewTickerService(cfg, db, redisClient, instrumentCache, keyring, enctokenVerifier, webhookService, quotaService, calendarService.Calendar())
 	defer tickerService.Close()
 	appLogger.Info("Ticker service initialized")
 
+	// Initialize instrument service and schedule the daily refresh
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	instrumentService := service.NewInstrumentService(db, cfg.InstrumentsSource, instrumentCache)
+	if cfg.InstrumentsRefreshAt != "off" {
+		go instrumentService.RunRefreshJob(jobsCtx, cfg.InstrumentsRefreshAt)
+	}
+	appLogger.Info("Instrument service initialized")
+
+	// Initialize retention of the logs tables and schedule the pruning
+	retentionService, err := service.NewRetentionService(cfg, db)
+	if err != nil {
+		logger.Fatal(slog.Default(), "Failed to initialize log retention", "error", err)
+	}
+	if cfg.LogPruneInterval > 0 {
+		go retentionService.RunPruneJob(jobsCtx, cfg.LogPruneInterval)
+	}
+
+	// Watch the feeds of the running tickers
+	if cfg.FeedCheckInterval > 0 {
+		go tickerService.RunFeedWatchdog(jobsCtx, cfg.FeedCheckInterval)
+	}
+
+	// Keep the calendar up to date, start and stop the scheduled tickers and
+	// publish the session boundaries
+	go calendarService.RunReloadJob(jobsCtx)
+	go tickerService.RunScheduler(jobsCtx)
+	go tickerService.RunMarketClock(jobsCtx)
+
+	// Initialize health service, not ready until the tickers are resumed
+	healthService := service.NewHealthService(cfg, db, redisClient, instrumentService, tickerService)
+
 	// Initialize Echo server
 	e := echo.New()
 	e.HideBanner = true
+	e.HidePort = true
 
 	// Initialize API routes
-	api.InitRoutes(e, cfg, db, tickerService)
+	if cfg.AdminToken == "" {
+		appLogger.Warn("MB_TDS_ADMIN_TOKEN is not set, admin routes are disabled")
+	}
+	if cfg.MetricsToken == "" {
+		appLogger.Warn("MB_TDS_METRICS_TOKEN is not set, /metrics is public and its labels include user IDs")
+	}
+	api.InitRoutes(e, cfg, db, enctokenVerifier, tickerService, webhookService, quotaService, healthService, instrumentService, instrumentCache)
+
+	// Re-encrypt stored enctokens with the active key and resume running tickers
+	if keyring != nil {
+		rotated, err := tickerService.RotateCredentials()
+		if err != nil {
+			appLogger.Error("Failed to rotate credentials", "error", err)
+		} else if rotated > 0 {
+			appLogger.Info("Credentials re-encrypted", "key_id", keyring.ActiveKeyID(), "credentials", rotated)
+		}
+
+		go func() {
+			tickerService.ResumeTickers()
+			healthService.SetPhase(service.PhaseReady)
+			appLogger.Info("Tickers resumed, service is ready")
+		}()
+	} else {
+		healthService.SetPhase(service.PhaseReady)
+	}
 
 	// Start server
 	go func() {
+		appLogger.Info("Server listening", "port", cfg.ServerPort)
 		if err := e.Start(":" + cfg.ServerPort); err != nil && err != http.ErrServerClosed {
-			appLogger.Error(fmt.Sprintf("Failed to start server: %v", err))
-			log.Fatalf("Failed to start server: %v", err)
+			logger.Fatal(slog.Default(), "Failed to start server", "error", err)
 		}
 	}()
 
@@ -73,15 +195,19 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
+	// Fail readiness and give the load balancer time to stop sending requests
+	healthService.SetPhase(service.PhaseDraining)
+	appLogger.Info("Draining before shutdown")
+	time.Sleep(cfg.ShutdownDrain)
+
 	// Shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// Log rather than exit on a failed shutdown, so the deferred closes run
 	if err := e.Shutdown(ctx); err != nil {
-		appLogger.Error(fmt.Sprintf("Failed to shutdown server: %v", err))
-		log.Fatal(err)
+		appLogger.Error("Failed to shutdown server", "error", err)
 	}
 
 	appLogger.Info("Server shut down gracefully")
-	log.Println("Server shut down gracefully")
 }
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nsvirk/moneybotstds/internal/models"
+	"github.com/nsvirk/moneybotstds/internal/service"
+	"github.com/nsvirk/moneybotstds/pkg/response"
+)
+
+// AdminTickerResponse is a ticker in the GET /admin/tickers response
+type AdminTickerResponse struct {
+	UserID      string `json:"user_id"`
+	BotID       string `json:"bot_id"`
+	Status      string `json:"status"`
+	Running     bool   `json:"running"`
+	Instruments int    `json:"instruments,omitempty"`
+	Options     string `json:"options,omitempty"`
+	StartedAt   string `json:"started_at,omitempty"`
+	StoppedAt   string `json:"stopped_at,omitempty"`
+}
+
+// AdminStopUserResponse is the response body for the POST /admin/users/:user_id/stop route
+type AdminStopUserResponse struct {
+	UserID  string   `json:"user_id"`
+	Stopped []string `json:"stopped"`
+}
+
+// AdminQuotaRequest is the request body for the PUT /admin/users/:user_id/quota
+// route. An unset or null limit uses the default, 0 is unlimited
+type AdminQuotaRequest struct {
+	MaxBots              *int `json:"max_bots"`
+	MaxInstrumentsPerBot *int `json:"max_instruments_per_bot"`
+	MaxInstruments       *int `json:"max_instruments"`
+	MaxCallsPerMinute    *int `json:"max_calls_per_minute"`
+}
+
+// AdminQuotaResponse is the response body for the /admin/users/:user_id/quota routes
+type AdminQuotaResponse struct {
+	UserID string      `json:"user_id"`
+	Limits QuotaLimits `json:"limits"`
+}
+
+// LogResponse is a row of the logs table
+type LogResponse struct {
+	ID        uint32 `json:"id"`
+	Timestamp string `json:"timestamp"`
+	Level     string `json:"level"`
+	Message   string `json:"message"`
+}
+
+// AdminHandler is the handler for the /admin routes
+type AdminHandler struct {
+	tickerService *service.TickerService
+	quotaService  *service.QuotaService
+	logService    *service.LogService
+}
+
+// NewAdminHandler creates a new AdminHandler
+func NewAdminHandler(tickerService *service.TickerService, quotaService *service.QuotaService, logService *service.LogService) *AdminHandler {
+	return &AdminHandler{tickerService: tickerService, quotaService: quotaService, logService: logService}
+}
+
+// ListTickers lists the tickers of all users, with a status if `status` is set
+func (h *AdminHandler) ListTickers(c echo.Context) error {
+	tickers, err := h.tickerService.ListTickers(c.QueryParam("status"))
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to get tickers: %v", err))
+	}
+
+	running := make(map[string]service.RunningTicker)
+	for _, ticker := range h.tickerService.RunningTickers() {
+		running[ticker.UserID+":"+ticker.BotID] = ticker
+	}
+
+	results := make([]AdminTickerResponse, 0, len(tickers))
+	for _, ticker := range tickers {
+		res := AdminTickerResponse{
+			UserID:    ticker.UserID,
+			BotID:     ticker.BotID,
+			Status:    ticker.Status,
+			Options:   ticker.Options,
+			StartedAt: ticker.StartedAt.Format(time.RFC3339),
+		}
+		if ticker.StoppedAt != nil {
+			res.StoppedAt = ticker.StoppedAt.Format(time.RFC3339)
+		}
+		if r, ok := running[ticker.UserID+":"+ticker.BotID]; ok {
+			res.Running = true
+			res.Instruments = r.Instruments
+		}
+		results = append(results, res)
+	}
+
+	return response.SuccessResponse(c, results)
+}
+
+// StopTicker force-stops the ticker of a bot
+func (h *AdminHandler) StopTicker(c echo.Context) error {
+	userID := c.Param("user_id")
+	botID := c.Param("bot_id")
+
+	err := h.tickerService.StopTicker(userID, botID)
+	if errors.Is(err, service.ErrTickerNotRunning) {
+		return response.ErrorResponse(c, http.StatusNotFound, "NotFoundException", fmt.Sprintf("Ticker not running: %s", botID))
+	}
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "TickerException", fmt.Sprintf("Failed to stop ticker: %v", err))
+	}
+
+	return response.SuccessResponse(c, StopPublishResponse{Message: "Publishing stopped successfully"})
+}
+
+// StopUserTickers force-stops all tickers of a user
+func (h *AdminHandler) StopUserTickers(c echo.Context) error {
+	userID := c.Param("user_id")
+
+	stopped, err := h.tickerService.StopUserTickers(userID)
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "TickerException", fmt.Sprintf("Failed to stop tickers, stopped %s: %v", strings.Join(stopped, ","), err))
+	}
+
+	return response.SuccessResponse(c, AdminStopUserResponse{UserID: userID, Stopped: stopped})
+}
+
+// GetQuota returns the effective quota of a user
+func (h *AdminHandler) GetQuota(c echo.Context) error {
+	userID := c.Param("user_id")
+
+	quota, err := h.quotaService.GetQuota(userID)
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to get quota: %v", err))
+	}
+
+	return response.SuccessResponse(c, AdminQuotaResponse{UserID: userID, Limits: newQuotaLimits(quota)})
+}
+
+// SetQuota sets the limits of a user, replacing any limits set before
+func (h *AdminHandler) SetQuota(c echo.Context) error {
+	var req AdminQuotaRequest
+	if err := c.Bind(&req); err != nil {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", "Invalid request body")
+	}
+
+	for _, limit := range []*int{req.MaxBots, req.MaxInstrumentsPerBot, req.MaxInstruments, req.MaxCallsPerMinute} {
+		if limit != nil && *limit < 0 {
+			return response.ErrorResponse(c, http.StatusBadRequest, "InputException", "Limits must not be negative")
+		}
+	}
+
+	userID := c.Param("user_id")
+
+	err := h.quotaService.SetQuota(&models.Quota{
+		UserID:               userID,
+		MaxBots:              req.MaxBots,
+		MaxInstrumentsPerBot: req.MaxInstrumentsPerBot,
+		MaxInstruments:       req.MaxInstruments,
+		MaxCallsPerMinute:    req.MaxCallsPerMinute,
+	})
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", err.Error())
+	}
+
+	return h.GetQuota(c)
+}
+
+// AppLogs returns the latest app logs, filtered by `level`
+func (h *AdminHandler) AppLogs(c echo.Context) error {
+	limit, err := logLimit(c)
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", err.Error())
+	}
+
+	logs, err := h.logService.RecentLogs(c.QueryParam("level"), limit)
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to get logs: %v", err))
+	}
+
+	results := make([]LogResponse, 0, len(logs))
+	for _, l := range logs {
+		results = append(results, LogResponse{
+			ID:        l.ID,
+			Timestamp: l.Timestamp.Format(time.RFC3339),
+			Level:     l.Level,
+			Message:   l.Message,
+		})
+	}
+
+	return response.SuccessResponse(c, results)
+}
+
+func logLimit(c echo.Context) (int, error) {
+	limit := c.QueryParam("limit")
+	if limit == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("`limit` must be a positive number")
+	}
+	return n, nil
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nsvirk/moneybotstds/internal/models"
+	"github.com/nsvirk/moneybotstds/internal/service"
+	"github.com/nsvirk/moneybotstds/pkg/response"
+)
+
+// CreateAPIKeyRequest is the request body for the POST /keys route
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// APIKeyResponse is an api key in the /keys responses. The secret is only
+// returned when the key is created
+type APIKeyResponse struct {
+	APIKey     string   `json:"api_key"`
+	APISecret  string   `json:"api_secret,omitempty"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  string   `json:"created_at"`
+	LastUsedAt string   `json:"last_used_at,omitempty"`
+}
+
+// APIKeyHandler is the handler for the /keys routes
+type APIKeyHandler struct {
+	apiKeyService *service.APIKeyService
+}
+
+// NewAPIKeyHandler creates a new APIKeyHandler
+func NewAPIKeyHandler(apiKeyService *service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{apiKeyService: apiKeyService}
+}
+
+// CreateAPIKey mints a new api key for the user
+func (h *APIKeyHandler) CreateAPIKey(c echo.Context) error {
+	var req CreateAPIKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", "Invalid request body")
+	}
+
+	userID := c.Get("userID").(string)
+
+	key, secret, err := h.apiKeyService.CreateAPIKey(userID, req.Name, req.Scopes)
+	if errors.Is(err, service.ErrUnknownScope) {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", fmt.Sprintf("Failed to create api key: %v", err))
+	}
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to create api key: %v", err))
+	}
+
+	res := newAPIKeyResponse(*key)
+	res.APISecret = secret
+
+	return response.SuccessResponse(c, res)
+}
+
+// ListAPIKeys lists the active api keys of the user
+func (h *APIKeyHandler) ListAPIKeys(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	keys, err := h.apiKeyService.ListAPIKeys(userID)
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to get api keys: %v", err))
+	}
+
+	results := make([]APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		results = append(results, newAPIKeyResponse(key))
+	}
+
+	return response.SuccessResponse(c, results)
+}
+
+// RevokeAPIKey revokes an api key of the user
+func (h *APIKeyHandler) RevokeAPIKey(c echo.Context) error {
+	userID := c.Get("userID").(string)
+	apiKey := c.Param("api_key")
+
+	err := h.apiKeyService.RevokeAPIKey(userID, apiKey)
+	if errors.Is(err, service.ErrInvalidAPIKey) {
+		return response.ErrorResponse(c, http.StatusNotFound, "NotFoundException", fmt.Sprintf("API key not found: %s", apiKey))
+	}
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to revoke api key: %v", err))
+	}
+
+	return response.SuccessResponse(c, map[string]string{"api_key": apiKey})
+}
+
+func newAPIKeyResponse(key models.APIKey) APIKeyResponse {
+	res := APIKeyResponse{
+		APIKey:    key.APIKey,
+		Name:      key.Name,
+		Scopes:    service.APIKeyScopes(&key),
+		CreatedAt: key.CreatedAt.Format(time.RFC3339),
+	}
+	if key.LastUsedAt != nil {
+		res.LastUsedAt = key.LastUsedAt.Format(time.RFC3339)
+	}
+	return res
+}
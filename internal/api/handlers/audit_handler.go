@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nsvirk/moneybotstds/internal/market"
+	"github.com/nsvirk/moneybotstds/internal/models"
+	"github.com/nsvirk/moneybotstds/internal/service"
+	"github.com/nsvirk/moneybotstds/pkg/response"
+)
+
+// AuditLogResponse is an audit log in the audit responses
+type AuditLogResponse struct {
+	ID         uint32 `json:"id"`
+	Timestamp  string `json:"timestamp"`
+	Actor      string `json:"actor"`
+	AuthScheme string `json:"auth_scheme,omitempty"`
+	UserID     string `json:"user_id"`
+	BotID      string `json:"bot_id,omitempty"`
+	Action     string `json:"action"`
+	Path       string `json:"path"`
+	Summary    string `json:"summary,omitempty"`
+	RemoteIP   string `json:"remote_ip"`
+	Status     int    `json:"status"`
+	Outcome    string `json:"outcome"`
+	Error      string `json:"error,omitempty"`
+	LatencyMs  int64  `json:"latency_ms"`
+}
+
+// AuditHandler is the handler for the /audit routes
+type AuditHandler struct {
+	auditService *service.AuditService
+}
+
+// NewAuditHandler creates a new AuditHandler
+func NewAuditHandler(auditService *service.AuditService) *AuditHandler {
+	return &AuditHandler{auditService: auditService}
+}
+
+// UserAuditLogs returns the audit logs of the user
+func (h *AuditHandler) UserAuditLogs(c echo.Context) error {
+	return h.auditLogs(c, c.Get("userID").(string))
+}
+
+// AdminAuditLogs returns the audit logs of all users, or of `user_id`
+func (h *AuditHandler) AdminAuditLogs(c echo.Context) error {
+	return h.auditLogs(c, c.QueryParam("user_id"))
+}
+
+func (h *AuditHandler) auditLogs(c echo.Context, userID string) error {
+	query := service.AuditQuery{
+		UserID: userID,
+		BotID:  c.QueryParam("bot_id"),
+	}
+
+	var err error
+	if query.From, err = parseQueryTime(c, "from"); err != nil {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", err.Error())
+	}
+	if query.To, err = parseQueryTime(c, "to"); err != nil {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", err.Error())
+	}
+
+	if limit := c.QueryParam("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return response.ErrorResponse(c, http.StatusBadRequest, "InputException", "`limit` must be a positive number")
+		}
+		query.Limit = n
+	}
+
+	auditLogs, err := h.auditService.Query(query)
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to get audit logs: %v", err))
+	}
+
+	results := make([]AuditLogResponse, 0, len(auditLogs))
+	for _, auditLog := range auditLogs {
+		results = append(results, newAuditLogResponse(auditLog))
+	}
+
+	return response.SuccessResponse(c, results)
+}
+
+// parseQueryTime parses a query param as an RFC 3339 time or a YYYY-MM-DD
+// date in IST. It returns the zero time if the param is not set
+func parseQueryTime(c echo.Context, name string) (time.Time, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, market.IST); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("`%s` must be an RFC 3339 time or a YYYY-MM-DD date", name)
+}
+
+func newAuditLogResponse(auditLog models.AuditLog) AuditLogResponse {
+	return AuditLogResponse{
+		ID:         auditLog.ID,
+		Timestamp:  auditLog.Timestamp.Format(time.RFC3339),
+		Actor:      auditLog.Actor,
+		AuthScheme: auditLog.AuthScheme,
+		UserID:     auditLog.UserID,
+		BotID:      auditLog.BotID,
+		Action:     auditLog.Action,
+		Path:       auditLog.Path,
+		Summary:    auditLog.Summary,
+		RemoteIP:   auditLog.RemoteIP,
+		Status:     auditLog.Status,
+		Outcome:    auditLog.Outcome,
+		Error:      auditLog.Error,
+		LatencyMs:  auditLog.LatencyMs,
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nsvirk/moneybotstds/internal/service"
+	"github.com/nsvirk/moneybotstds/pkg/response"
+)
+
+// HealthResponse is the response body for the /healthz route
+type HealthResponse struct {
+	Status        string `json:"status"`
+	Phase         string `json:"phase"`
+	UptimeSeconds int64  `json:"uptime_seconds"`
+}
+
+// HealthHandler is the handler for the /healthz and /readyz routes
+type HealthHandler struct {
+	healthService *service.HealthService
+}
+
+// NewHealthHandler creates a new HealthHandler
+func NewHealthHandler(healthService *service.HealthService) *HealthHandler {
+	return &HealthHandler{healthService: healthService}
+}
+
+// Healthz reports that the process is alive. It does not check dependencies,
+// so an outage of Postgres or Redis does not restart the service
+func (h *HealthHandler) Healthz(c echo.Context) error {
+	return response.SuccessResponse(c, HealthResponse{
+		Status:        service.StatusOK,
+		Phase:         h.healthService.Phase(),
+		UptimeSeconds: int64(h.healthService.Uptime().Seconds()),
+	})
+}
+
+// Readyz reports whether the service can take traffic, with the status of
+// each dependency. It returns 503 while starting, draining or if a dependency
+// failed
+func (h *HealthHandler) Readyz(c echo.Context) error {
+	readiness := h.healthService.Readiness(c.Request().Context())
+	if !readiness.Ready {
+		return c.JSON(http.StatusServiceUnavailable, response.Response{
+			Status:    "error",
+			Data:      readiness,
+			ErrorType: "GeneralException",
+			Message:   "Service is not ready",
+		})
+	}
+
+	return response.SuccessResponse(c, readiness)
+}
@@ -1,24 +1,41 @@
 package handlers
 
 import (
+	"fmt"
+	"net/http"
+	"time"
+
 	"github.com/labstack/echo/v4"
 	"github.com/nsvirk/moneybotstds/internal/config"
+	"github.com/nsvirk/moneybotstds/internal/service"
 	"github.com/nsvirk/moneybotstds/pkg/response"
 )
 
-// IndexHandler is the handler for the /publish routes
+// IndexHandler is the handler for the / route
 type IndexHandler struct {
-	cfg *config.Config
+	cfg               *config.Config
+	instrumentService *service.InstrumentService
 }
 
 // NewIndexHandler creates a new IndexHandler
-func NewIndexHandler(cfg *config.Config) *IndexHandler {
-	return &IndexHandler{cfg: cfg}
+func NewIndexHandler(cfg *config.Config, instrumentService *service.InstrumentService) *IndexHandler {
+	return &IndexHandler{cfg: cfg, instrumentService: instrumentService}
 }
 
 func (h *IndexHandler) Index(c echo.Context) error {
+	refreshedAt, err := h.instrumentService.LastRefreshedAt()
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to get instruments refresh time: %v", err))
+	}
+
+	instrumentsRefreshedAt := ""
+	if !refreshedAt.IsZero() {
+		instrumentsRefreshedAt = refreshedAt.Format(time.RFC3339)
+	}
+
 	return response.SuccessResponse(c, map[string]string{
-		"app_name":    h.cfg.AppName,
-		"app_version": h.cfg.AppVersion,
+		"app_name":                 h.cfg.AppName,
+		"app_version":              h.cfg.AppVersion,
+		"instruments_refreshed_at": instrumentsRefreshedAt,
 	})
 }
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nsvirk/moneybotstds/internal/models"
+	"github.com/nsvirk/moneybotstds/internal/service"
+	"github.com/nsvirk/moneybotstds/pkg/response"
+	"gorm.io/gorm"
+)
+
+// InstrumentResponse is an instrument in the /instruments responses
+type InstrumentResponse struct {
+	InstrumentToken uint32  `json:"instrument_token"`
+	Exchange        string  `json:"exchange"`
+	Tradingsymbol   string  `json:"tradingsymbol"`
+	Name            string  `json:"name"`
+	Segment         string  `json:"segment"`
+	InstrumentType  string  `json:"instrument_type"`
+	Expiry          string  `json:"expiry,omitempty"`
+	Strike          float64 `json:"strike"`
+	LotSize         int     `json:"lot_size"`
+	TickSize        float64 `json:"tick_size"`
+}
+
+// InstrumentCacheStatsResponse is the response body for the /admin/instruments/cache routes
+type InstrumentCacheStatsResponse struct {
+	Instruments  int    `json:"instruments"`
+	LoadedAt     string `json:"loaded_at"`
+	LoadDuration string `json:"load_duration"`
+	Hits         uint64 `json:"hits"`
+	Misses       uint64 `json:"misses"`
+}
+
+// InstrumentHandler is the handler for the /instruments routes
+type InstrumentHandler struct {
+	instrumentService *service.InstrumentService
+}
+
+// NewInstrumentHandler creates a new InstrumentHandler
+func NewInstrumentHandler(instrumentService *service.InstrumentService) *InstrumentHandler {
+	return &InstrumentHandler{instrumentService: instrumentService}
+}
+
+// Search searches instruments by tradingsymbol or name
+func (h *InstrumentHandler) Search(c echo.Context) error {
+	query := service.InstrumentQuery{
+		Q:        c.QueryParam("q"),
+		Exchange: c.QueryParam("exchange"),
+		Segment:  c.QueryParam("segment"),
+	}
+
+	if query.Q == "" && query.Exchange == "" && query.Segment == "" {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", "One of `q`, `exchange` or `segment` is required")
+	}
+
+	if expiry := c.QueryParam("expiry"); expiry != "" {
+		t, err := time.Parse("2006-01-02", expiry)
+		if err != nil {
+			return response.ErrorResponse(c, http.StatusBadRequest, "InputException", "`expiry` must be YYYY-MM-DD")
+		}
+		query.Expiry = &t
+	}
+
+	if limit := c.QueryParam("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return response.ErrorResponse(c, http.StatusBadRequest, "InputException", "`limit` must be a positive number")
+		}
+		query.Limit = n
+	}
+
+	instruments := h.instrumentService.Search(query)
+
+	results := make([]InstrumentResponse, 0, len(instruments))
+	for _, instrument := range instruments {
+		results = append(results, newInstrumentResponse(instrument))
+	}
+
+	return response.SuccessResponse(c, results)
+}
+
+// Lookup gets an instrument by exchange and tradingsymbol
+func (h *InstrumentHandler) Lookup(c echo.Context) error {
+	exchange, tradingsymbol := c.Param("exchange"), c.Param("tradingsymbol")
+
+	instrument, err := h.instrumentService.Lookup(exchange, tradingsymbol)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return response.ErrorResponse(c, http.StatusNotFound, "NotFoundException", fmt.Sprintf("Instrument not found: %s:%s", exchange, tradingsymbol))
+		}
+		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to get instrument: %v", err))
+	}
+
+	return response.SuccessResponse(c, newInstrumentResponse(*instrument))
+}
+
+// CacheStats gets the instrument cache statistics
+func (h *InstrumentHandler) CacheStats(c echo.Context) error {
+	return response.SuccessResponse(c, newInstrumentCacheStatsResponse(h.instrumentService.CacheStats()))
+}
+
+// ReloadCache reloads the instrument cache from the database
+func (h *InstrumentHandler) ReloadCache(c echo.Context) error {
+	if err := h.instrumentService.ReloadCache(); err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to reload instrument cache: %v", err))
+	}
+
+	return response.SuccessResponse(c, newInstrumentCacheStatsResponse(h.instrumentService.CacheStats()))
+}
+
+func newInstrumentCacheStatsResponse(stats service.InstrumentCacheStats) InstrumentCacheStatsResponse {
+	res := InstrumentCacheStatsResponse{
+		Instruments:  stats.Instruments,
+		LoadDuration: stats.LoadDuration.String(),
+		Hits:         stats.Hits,
+		Misses:       stats.Misses,
+	}
+	if !stats.LoadedAt.IsZero() {
+		res.LoadedAt = stats.LoadedAt.Format(time.RFC3339)
+	}
+	return res
+}
+
+func newInstrumentResponse(instrument models.Instrument) InstrumentResponse {
+	res := InstrumentResponse{
+		InstrumentToken: instrument.InstrumentToken,
+		Exchange:        instrument.Exchange,
+		Tradingsymbol:   instrument.Tradingsymbol,
+		Name:            instrument.Name,
+		Segment:         instrument.Segment,
+		InstrumentType:  instrument.InstrumentType,
+		Strike:          instrument.Strike,
+		LotSize:         instrument.LotSize,
+		TickSize:        instrument.TickSize,
+	}
+	if instrument.Expiry != nil {
+		res.Expiry = instrument.Expiry.Format("2006-01-02")
+	}
+	return res
+}
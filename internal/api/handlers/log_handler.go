@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nsvirk/moneybotstds/internal/logger"
+	"github.com/nsvirk/moneybotstds/internal/models"
+	"github.com/nsvirk/moneybotstds/internal/service"
+	"github.com/nsvirk/moneybotstds/pkg/response"
+)
+
+// How often a tail polls for new ticker logs, and sends a comment to keep
+// idle connections open
+const (
+	tailPollInterval = time.Second
+	tailKeepAlive    = 15 * time.Second
+)
+
+// TickerLogResponse is a row of the ticker_logs table
+type TickerLogResponse struct {
+	ID        uint32 `json:"id"`
+	Timestamp string `json:"timestamp"`
+	UserID    string `json:"user_id"`
+	BotID     string `json:"bot_id"`
+	Level     string `json:"level"`
+	EventType string `json:"event_type"`
+	Message   string `json:"message"`
+}
+
+// TickerLogsResponse is a page of ticker logs. NextBeforeID is set if there
+// may be older logs, pass it as `before_id` to get them
+type TickerLogsResponse struct {
+	Logs         []TickerLogResponse `json:"logs"`
+	NextBeforeID uint32              `json:"next_before_id,omitempty"`
+}
+
+// LogHandler is the handler for the /logs routes
+type LogHandler struct {
+	logService *service.LogService
+
+	// Closed to end the streams when the server shuts down
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewLogHandler creates a new LogHandler
+func NewLogHandler(logService *service.LogService) *LogHandler {
+	return &LogHandler{logService: logService, done: make(chan struct{})}
+}
+
+// Close ends the open streams, the server does not wait for them on shutdown
+func (h *LogHandler) Close() {
+	h.closeOnce.Do(func() { close(h.done) })
+}
+
+// UserTickerLogs returns the ticker logs of the user
+func (h *LogHandler) UserTickerLogs(c echo.Context) error {
+	return h.tickerLogs(c, c.Get("userID").(string))
+}
+
+// AdminTickerLogs returns the ticker logs of all users, or of `user_id`
+func (h *LogHandler) AdminTickerLogs(c echo.Context) error {
+	return h.tickerLogs(c, c.QueryParam("user_id"))
+}
+
+func (h *LogHandler) tickerLogs(c echo.Context, userID string) error {
+	query := service.TickerLogQuery{Filter: tickerLogFilter(c, userID)}
+
+	var err error
+	if query.Since, err = parseQueryTime(c, "since"); err != nil {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", err.Error())
+	}
+	if query.Until, err = parseQueryTime(c, "until"); err != nil {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", err.Error())
+	}
+	if query.BeforeID, err = queryLogID(c, "before_id"); err != nil {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", err.Error())
+	}
+	if query.Limit, err = logLimit(c); err != nil {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", err.Error())
+	}
+
+	tickerLogs, nextBeforeID, err := h.logService.QueryTickerLogs(query)
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to get ticker logs: %v", err))
+	}
+
+	res := TickerLogsResponse{
+		Logs:         make([]TickerLogResponse, 0, len(tickerLogs)),
+		NextBeforeID: nextBeforeID,
+	}
+	for _, tickerLog := range tickerLogs {
+		res.Logs = append(res.Logs, newTickerLogResponse(tickerLog))
+	}
+
+	return response.SuccessResponse(c, res)
+}
+
+// StreamTickerLogs streams the new ticker logs of the user as server-sent
+// events, filtered like UserTickerLogs. The stream starts after the latest
+// log, or after `after_id` or the Last-Event-ID header to resume a stream
+func (h *LogHandler) StreamTickerLogs(c echo.Context) error {
+	filter := tickerLogFilter(c, c.Get("userID").(string))
+
+	afterID, err := queryLogID(c, "after_id")
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", err.Error())
+	}
+	if lastEventID := c.Request().Header.Get("Last-Event-ID"); lastEventID != "" {
+		id, err := strconv.ParseUint(lastEventID, 10, 32)
+		if err != nil {
+			return response.ErrorResponse(c, http.StatusBadRequest, "InputException", "Last-Event-ID must be a log id")
+		}
+		afterID = uint32(id)
+	}
+	if afterID == 0 {
+		if afterID, err = h.logService.LastTickerLogID(); err != nil {
+			return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to get ticker logs: %v", err))
+		}
+	}
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.Header().Set(echo.HeaderConnection, "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	w.Flush()
+
+	ctx := c.Request().Context()
+	poll := time.NewTicker(tailPollInterval)
+	defer poll.Stop()
+	lastWrite := time.Now()
+	failing := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-h.done:
+			return nil
+		case <-poll.C:
+		}
+
+		tickerLogs, err := h.logService.TickerLogsAfter(filter, afterID)
+		if err != nil {
+			// Keep the stream open, the next poll retries
+			if !failing {
+				slog.ErrorContext(ctx, "Failed to get ticker logs to stream", "error", err, logger.KeyUserID, filter.UserID)
+			}
+			failing = true
+			continue
+		}
+		failing = false
+
+		for _, tickerLog := range tickerLogs {
+			data, err := json.Marshal(newTickerLogResponse(tickerLog))
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: ticker_log\ndata: %s\n\n", tickerLog.ID, data); err != nil {
+				return nil
+			}
+			afterID = tickerLog.ID
+		}
+
+		if len(tickerLogs) == 0 {
+			if time.Since(lastWrite) < tailKeepAlive {
+				continue
+			}
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+		}
+		w.Flush()
+		lastWrite = time.Now()
+	}
+}
+
+// tickerLogFilter returns the filter of the `bot_id`, `level` and
+// `event_type` query params for the logs of userID
+func tickerLogFilter(c echo.Context, userID string) models.TickerLog {
+	return models.TickerLog{
+		UserID:    userID,
+		BotID:     c.QueryParam("bot_id"),
+		Level:     strings.ToUpper(c.QueryParam("level")),
+		EventType: c.QueryParam("event_type"),
+	}
+}
+
+// queryLogID parses a query param as a log id, 0 if it is not set
+func queryLogID(c echo.Context, name string) (uint32, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("`%s` must be a log id", name)
+	}
+	return uint32(id), nil
+}
+
+func newTickerLogResponse(tickerLog models.TickerLog) TickerLogResponse {
+	return TickerLogResponse{
+		ID:        tickerLog.ID,
+		Timestamp: tickerLog.Timestamp.Format(time.RFC3339),
+		UserID:    tickerLog.UserID,
+		BotID:     tickerLog.BotID,
+		Level:     tickerLog.Level,
+		EventType: tickerLog.EventType,
+		Message:   tickerLog.Message,
+	}
+}
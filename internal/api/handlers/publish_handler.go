@@ -1,9 +1,10 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
-	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/nsvirk/moneybotstds/internal/service"
@@ -13,19 +14,52 @@ import (
 
 // StartPublishRequest is the request body for the /publish/start route
 type StartPublishRequest struct {
-	BotID             string   `json:"bot_id"`
-	TickerInstruments []string `json:"ticker_instruments"`
+	BotID             string           `json:"bot_id"`
+	TickerInstruments []string         `json:"ticker_instruments"`
+	EnrichGreeks      bool             `json:"enrich_greeks"`
+	Metadata          string           `json:"metadata"`
+	Schedule          *ScheduleRequest `json:"schedule"`
 }
 
+// ScheduleRequest is the trading hours schedule of a ticker in the
+// /publish/start request, durations like `5m`
+type ScheduleRequest struct {
+	BeforeOpen string `json:"before_open"`
+	AfterClose string `json:"after_close"`
+}
+
+// Default and maximum margins of a schedule around the trading hours
+const (
+	defaultScheduleMargin = 5 * time.Minute
+	maxScheduleMargin     = 6 * time.Hour
+)
+
 // StopPublishRequest is the request body for the /publish/stop route
 type StopPublishRequest struct {
 	BotID string `json:"bot_id"`
 }
 
+// ResumePublishRequest is the request body for the /publish/resume route
+type ResumePublishRequest struct {
+	BotID string `json:"bot_id"`
+}
+
 // StartPublishResponse is the response body for the /publish/start route
 type StartPublishResponse struct {
 	PublishedChannel string `json:"published_channel,omitempty"`
+	EventsChannel    string `json:"events_channel,omitempty"`
+	MetadataChannel  string `json:"metadata_channel,omitempty"`
+	MetadataKey      string `json:"metadata_key,omitempty"`
 	SubscribedCount  int    `json:"subscribed_count"`
+	NextStart        string `json:"next_start,omitempty"`
+}
+
+// ResumePublishResponse is the response body for the /publish/resume route
+type ResumePublishResponse struct {
+	PublishedChannel string `json:"published_channel"`
+	EventsChannel    string `json:"events_channel"`
+	Message          string `json:"message"`
+	NextStart        string `json:"next_start,omitempty"`
 }
 
 // StopPublishResponse is the response body for the /publish/stop route
@@ -35,18 +69,20 @@ type StopPublishResponse struct {
 
 // PublishHandler is the handler for the /publish routes
 type PublishHandler struct {
-	DB            *gorm.DB
-	tickerService *service.TickerService
+	DB              *gorm.DB
+	tickerService   *service.TickerService
+	instrumentCache *service.InstrumentCache
 }
 
 // NewPublishHandler creates a new PublishHandler
-func NewPublishHandler(DB *gorm.DB, tickerService *service.TickerService) *PublishHandler {
-	return &PublishHandler{DB: DB, tickerService: tickerService}
+func NewPublishHandler(DB *gorm.DB, tickerService *service.TickerService, instrumentCache *service.InstrumentCache) *PublishHandler {
+	return &PublishHandler{DB: DB, tickerService: tickerService, instrumentCache: instrumentCache}
 }
 
 // StartPublishing starts the publishing of ticks
 func (h *PublishHandler) StartPublishing(c echo.Context) error {
-	db := service.NewDBService(h.DB)
+	ctx := c.Request().Context()
+	db := service.NewDBService(h.DB.WithContext(ctx), h.instrumentCache)
 
 	var req StartPublishRequest
 	if err := c.Bind(&req); err != nil {
@@ -57,15 +93,19 @@ func (h *PublishHandler) StartPublishing(c echo.Context) error {
 		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", "`bot_id` and `ticker_instruments` are required")
 	}
 
-	// Parse Authorization header
-	auth := c.Request().Header.Get("Authorization")
-	parts := strings.SplitN(auth, ":", 2)
-	if len(parts) != 2 {
-		return response.ErrorResponse(c, http.StatusUnauthorized, "AuthorizationException", "Invalid Authorization header")
+	if req.Metadata != "" && req.Metadata != service.MetadataEmbed && req.Metadata != service.MetadataChannel {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", "`metadata` must be `embed` or `channel`")
+	}
+
+	schedule, err := parseSchedule(req.Schedule)
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", err.Error())
 	}
 
-	// Get userID and enctoken
-	userID, enctoken := parts[0], parts[1]
+	// Get userID and enctoken set by the auth middleware, the enctoken is
+	// empty for api keys and the ticker uses the stored one
+	userID := c.Get("userID").(string)
+	enctoken := c.Get("enctoken").(string)
 
 	// Get instrument tokens from the database
 	instrumentTokenMap, err := db.MakeTickerInstrumentTokenMap(req.TickerInstruments)
@@ -73,9 +113,24 @@ func (h *PublishHandler) StartPublishing(c echo.Context) error {
 		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", "Failed to get instrument tokens")
 	}
 
+	// Check the bot can start before replacing its stored instruments
+	if schedule != nil {
+		err = h.tickerService.CheckSchedule(userID, req.BotID, len(instrumentTokenMap))
+	} else {
+		err = h.tickerService.CheckStart(userID, req.BotID, len(instrumentTokenMap))
+	}
+	if errors.Is(err, service.ErrTickerRunning) {
+		return response.ErrorResponse(c, http.StatusConflict, "TickerException", err.Error())
+	}
+	if errors.Is(err, service.ErrQuotaExceeded) {
+		return response.ErrorResponse(c, http.StatusTooManyRequests, "QuotaExceeded", err.Error())
+	}
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to check quota: %v", err))
+	}
+
 	// Save user info to the database
-	instrumentCt := len(instrumentTokenMap)
-	if err := db.SaveUserConnection(userID, enctoken, instrumentCt); err != nil {
+	if err := db.SaveUserConnection(userID, enctoken, len(instrumentTokenMap)); err != nil {
 		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to store user connection: %v", err))
 	}
 
@@ -90,8 +145,39 @@ func (h *PublishHandler) StartPublishing(c echo.Context) error {
 		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to get instruments: %v", err))
 	}
 
-	// Start ticker
-	err = h.tickerService.StartTicker(userID, enctoken, req.BotID, tickerInstruments)
+	// Start ticker, scheduled tickers only start within their trading hours
+	tickerOptions := service.TickerOptions{
+		EnrichGreeks: req.EnrichGreeks,
+		Metadata:     req.Metadata,
+		Schedule:     schedule,
+	}
+	var nextStart time.Time
+	if schedule != nil {
+		nextStart, err = h.tickerService.ScheduleTicker(ctx, userID, enctoken, req.BotID, tickerInstruments, tickerOptions)
+	} else {
+		err = h.tickerService.StartTicker(ctx, userID, enctoken, req.BotID, tickerInstruments, tickerOptions)
+	}
+	if schedule != nil && errors.Is(err, service.ErrCredentialsDisabled) {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", "`schedule` requires credential storage, which is not configured")
+	}
+	if errors.Is(err, service.ErrNoTradingSession) {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", fmt.Sprintf("Cannot schedule ticker: %v", err))
+	}
+	if errors.Is(err, service.ErrCredentialsDisabled) {
+		return response.ErrorResponse(c, http.StatusUnauthorized, "AuthorizationException", "Enctoken storage is not configured on this server, authenticate with an enctoken")
+	}
+	if errors.Is(err, service.ErrNoCredential) {
+		return response.ErrorResponse(c, http.StatusUnauthorized, "AuthorizationException", "No enctoken registered, register one with POST /session")
+	}
+	if errors.Is(err, service.ErrSessionExpired) {
+		return response.ErrorResponse(c, http.StatusUnauthorized, "AuthorizationException", "Kite session expired, register a fresh enctoken with POST /session")
+	}
+	if errors.Is(err, service.ErrTickerRunning) {
+		return response.ErrorResponse(c, http.StatusConflict, "TickerException", err.Error())
+	}
+	if errors.Is(err, service.ErrQuotaExceeded) {
+		return response.ErrorResponse(c, http.StatusTooManyRequests, "QuotaExceeded", err.Error())
+	}
 	if err != nil {
 		return response.ErrorResponse(c, http.StatusInternalServerError, "TickerException", fmt.Sprintf("Failed to start ticker: %v", err))
 	}
@@ -102,8 +188,16 @@ func (h *PublishHandler) StartPublishing(c echo.Context) error {
 	// Make response
 	startPublishResponse := StartPublishResponse{
 		PublishedChannel: ticksChannel,
+		EventsChannel:    h.tickerService.GetEventsChannel(userID, req.BotID),
 		SubscribedCount:  len(tickerInstruments),
 	}
+	if !nextStart.IsZero() {
+		startPublishResponse.NextStart = nextStart.Format(time.RFC3339)
+	}
+	if req.Metadata == service.MetadataChannel {
+		startPublishResponse.MetadataChannel = h.tickerService.GetMetadataChannel(userID, req.BotID)
+		startPublishResponse.MetadataKey = h.tickerService.GetMetadataKey(userID, req.BotID)
+	}
 
 	// Send success response
 	return response.SuccessResponse(c, startPublishResponse)
@@ -121,18 +215,14 @@ func (h *PublishHandler) StopPublishing(c echo.Context) error {
 		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", "`bot_id` is required")
 	}
 
-	// Parse Authorization header
-	auth := c.Request().Header.Get("Authorization")
-	parts := strings.SplitN(auth, ":", 2)
-	if len(parts) != 2 {
-		return response.ErrorResponse(c, http.StatusUnauthorized, "AuthorizationException", "Invalid Authorization header")
-	}
-
-	// Get userID
-	userID := parts[0]
+	// Get userID set by the auth middleware
+	userID := c.Get("userID").(string)
 
 	// Stop ticker
 	err := h.tickerService.StopTicker(userID, req.BotID)
+	if errors.Is(err, service.ErrTickerNotRunning) {
+		return response.ErrorResponse(c, http.StatusNotFound, "NotFoundException", fmt.Sprintf("Ticker not running: %s", req.BotID))
+	}
 	if err != nil {
 		return response.ErrorResponse(c, http.StatusInternalServerError, "TickerException", fmt.Sprintf("Failed to stop ticker: %v", err))
 	}
@@ -145,3 +235,84 @@ func (h *PublishHandler) StopPublishing(c echo.Context) error {
 	// Send success response
 	return response.SuccessResponse(c, stopPublishResponse)
 }
+
+// ResumePublishing restarts a ticker stopped by an expired Kite session with
+// its instruments and options, using the enctoken of the request or the
+// stored one for api keys
+func (h *PublishHandler) ResumePublishing(c echo.Context) error {
+
+	var req ResumePublishRequest
+	if err := c.Bind(&req); err != nil {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", "Invalid request body")
+	}
+
+	if req.BotID == "" {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", "`bot_id` is required")
+	}
+
+	// Get userID and enctoken set by the auth middleware
+	userID := c.Get("userID").(string)
+	enctoken := c.Get("enctoken").(string)
+
+	// Resume ticker
+	nextStart, err := h.tickerService.ResumeTicker(c.Request().Context(), userID, enctoken, req.BotID)
+	switch {
+	case errors.Is(err, service.ErrTickerNotFound):
+		return response.ErrorResponse(c, http.StatusNotFound, "NotFoundException", fmt.Sprintf("Ticker not found for bot %s", req.BotID))
+	case errors.Is(err, service.ErrTickerNotExpired):
+		return response.ErrorResponse(c, http.StatusConflict, "TickerException", "Ticker session has not expired, use /publish/start")
+	case errors.Is(err, service.ErrCredentialsDisabled):
+		return response.ErrorResponse(c, http.StatusUnauthorized, "AuthorizationException", "Enctoken storage is not configured on this server, authenticate with an enctoken")
+	case errors.Is(err, service.ErrNoCredential):
+		return response.ErrorResponse(c, http.StatusUnauthorized, "AuthorizationException", "No enctoken registered, register one with POST /session")
+	case errors.Is(err, service.ErrSessionExpired):
+		return response.ErrorResponse(c, http.StatusUnauthorized, "AuthorizationException", "Kite session expired, register a fresh enctoken with POST /session")
+	case errors.Is(err, service.ErrQuotaExceeded):
+		return response.ErrorResponse(c, http.StatusTooManyRequests, "QuotaExceeded", err.Error())
+	case err != nil:
+		return response.ErrorResponse(c, http.StatusInternalServerError, "TickerException", fmt.Sprintf("Failed to resume ticker: %v", err))
+	}
+
+	// Make response
+	resumePublishResponse := ResumePublishResponse{
+		PublishedChannel: h.tickerService.GetTicksChannel(userID, req.BotID),
+		EventsChannel:    h.tickerService.GetEventsChannel(userID, req.BotID),
+		Message:          "Publishing resumed successfully",
+	}
+	if !nextStart.IsZero() {
+		resumePublishResponse.Message = "Publishing scheduled to resume with the trading hours"
+		resumePublishResponse.NextStart = nextStart.Format(time.RFC3339)
+	}
+
+	// Send success response
+	return response.SuccessResponse(c, resumePublishResponse)
+}
+
+// parseSchedule parses the schedule of a start request, nil if not set.
+// Margins default to defaultScheduleMargin
+func parseSchedule(req *ScheduleRequest) (*service.Schedule, error) {
+	if req == nil {
+		return nil, nil
+	}
+
+	parse := func(name, value string) (time.Duration, error) {
+		if value == "" {
+			return defaultScheduleMargin, nil
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 || d > maxScheduleMargin {
+			return 0, fmt.Errorf("`schedule.%s` must be a duration between 0s and %v", name, maxScheduleMargin)
+		}
+		return d, nil
+	}
+
+	beforeOpen, err := parse("before_open", req.BeforeOpen)
+	if err != nil {
+		return nil, err
+	}
+	afterClose, err := parse("after_close", req.AfterClose)
+	if err != nil {
+		return nil, err
+	}
+	return &service.Schedule{BeforeOpen: beforeOpen, AfterClose: afterClose}, nil
+}
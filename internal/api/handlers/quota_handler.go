@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nsvirk/moneybotstds/internal/service"
+	"github.com/nsvirk/moneybotstds/pkg/response"
+)
+
+// QuotaLimits are the limits of a user, 0 is unlimited
+type QuotaLimits struct {
+	MaxBots              int `json:"max_bots"`
+	MaxInstrumentsPerBot int `json:"max_instruments_per_bot"`
+	MaxInstruments       int `json:"max_instruments"`
+	MaxCallsPerMinute    int `json:"max_calls_per_minute"`
+}
+
+// QuotaUsage is the current usage of a user
+type QuotaUsage struct {
+	Bots          int `json:"bots"`
+	Instruments   int `json:"instruments"`
+	CallsInMinute int `json:"calls_in_minute"`
+}
+
+// QuotaResponse is the response body for the /me/quota route
+type QuotaResponse struct {
+	UserID string      `json:"user_id"`
+	Limits QuotaLimits `json:"limits"`
+	Usage  QuotaUsage  `json:"usage"`
+}
+
+// QuotaHandler is the handler for the /me/quota route
+type QuotaHandler struct {
+	quotaService  *service.QuotaService
+	tickerService *service.TickerService
+}
+
+// NewQuotaHandler creates a new QuotaHandler
+func NewQuotaHandler(quotaService *service.QuotaService, tickerService *service.TickerService) *QuotaHandler {
+	return &QuotaHandler{quotaService: quotaService, tickerService: tickerService}
+}
+
+// GetQuota returns the quota of the user and its usage
+func (h *QuotaHandler) GetQuota(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	quota, err := h.quotaService.GetQuota(userID)
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to get quota: %v", err))
+	}
+
+	bots, instruments := h.tickerService.Usage(userID)
+
+	return response.SuccessResponse(c, QuotaResponse{
+		UserID: userID,
+		Limits: newQuotaLimits(quota),
+		Usage: QuotaUsage{
+			Bots:          bots,
+			Instruments:   instruments,
+			CallsInMinute: h.quotaService.CallsInWindow(userID),
+		},
+	})
+}
+
+func newQuotaLimits(quota service.Quota) QuotaLimits {
+	return QuotaLimits{
+		MaxBots:              quota.MaxBots,
+		MaxInstrumentsPerBot: quota.MaxInstrumentsPerBot,
+		MaxInstruments:       quota.MaxInstruments,
+		MaxCallsPerMinute:    quota.MaxCallsPerMinute,
+	}
+}
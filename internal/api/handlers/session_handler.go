@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nsvirk/moneybotstds/internal/service"
+	"github.com/nsvirk/moneybotstds/pkg/response"
+)
+
+// SessionResponse is the response body for the /session routes
+type SessionResponse struct {
+	UserID string `json:"user_id"`
+}
+
+// SessionHandler is the handler for the /session routes
+type SessionHandler struct {
+	tickerService *service.TickerService
+}
+
+// NewSessionHandler creates a new SessionHandler
+func NewSessionHandler(tickerService *service.TickerService) *SessionHandler {
+	return &SessionHandler{tickerService: tickerService}
+}
+
+// Register stores the enctoken of the request for use with API keys and resumes
+func (h *SessionHandler) Register(c echo.Context) error {
+	userID := c.Get("userID").(string)
+	enctoken := c.Get("enctoken").(string)
+
+	err := h.tickerService.SaveCredential(userID, enctoken)
+	if errors.Is(err, service.ErrCredentialsDisabled) {
+		return response.ErrorResponse(c, http.StatusNotImplemented, "GeneralException", "Enctoken storage is not configured on this server")
+	}
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to store enctoken: %v", err))
+	}
+
+	return response.SuccessResponse(c, SessionResponse{UserID: userID})
+}
+
+// Remove deletes the stored enctoken of the user
+func (h *SessionHandler) Remove(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	if err := h.tickerService.RemoveCredential(userID); err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to delete enctoken: %v", err))
+	}
+
+	return response.SuccessResponse(c, SessionResponse{UserID: userID})
+}
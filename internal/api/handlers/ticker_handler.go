@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nsvirk/moneybotstds/internal/service"
+	"github.com/nsvirk/moneybotstds/pkg/response"
+)
+
+// LatencyStatsResponse is a latency distribution in milliseconds
+type LatencyStatsResponse struct {
+	Count int     `json:"count"`
+	P50Ms float64 `json:"p50_ms"`
+	P90Ms float64 `json:"p90_ms"`
+	P99Ms float64 `json:"p99_ms"`
+	MaxMs float64 `json:"max_ms"`
+}
+
+// InstrumentLatencyResponse is the latency of an instrument in the latency
+// response
+type InstrumentLatencyResponse struct {
+	Instrument string               `json:"instrument"`
+	Token      uint32               `json:"instrument_token"`
+	LastMs     float64              `json:"last_ms"`
+	Total      LatencyStatsResponse `json:"total"`
+	Slow       bool                 `json:"slow"`
+	SlowSince  string               `json:"slow_since,omitempty"`
+}
+
+// TickerLatencyResponse is the response body for the latency routes
+type TickerLatencyResponse struct {
+	UserID      string                      `json:"user_id"`
+	BotID       string                      `json:"bot_id"`
+	ThresholdMs float64                     `json:"threshold_ms"`
+	Feed        LatencyStatsResponse        `json:"feed"`
+	Publish     LatencyStatsResponse        `json:"publish"`
+	Total       LatencyStatsResponse        `json:"total"`
+	Slow        int                         `json:"slow"`
+	Instruments []InstrumentLatencyResponse `json:"instruments"`
+}
+
+// TickerHandler is the handler for the /tickers routes
+type TickerHandler struct {
+	tickerService *service.TickerService
+}
+
+// NewTickerHandler creates a new TickerHandler
+func NewTickerHandler(tickerService *service.TickerService) *TickerHandler {
+	return &TickerHandler{tickerService: tickerService}
+}
+
+// Latency returns the tick latency of a running ticker of the user
+func (h *TickerHandler) Latency(c echo.Context) error {
+	return h.latency(c, c.Get("userID").(string), c.Param("bot_id"))
+}
+
+// AdminLatency returns the tick latency of a running ticker of any user
+func (h *TickerHandler) AdminLatency(c echo.Context) error {
+	return h.latency(c, c.Param("user_id"), c.Param("bot_id"))
+}
+
+func (h *TickerHandler) latency(c echo.Context, userID, botID string) error {
+	latency, err := h.tickerService.TickerLatency(userID, botID)
+	if errors.Is(err, service.ErrTickerNotRunning) {
+		return response.ErrorResponse(c, http.StatusNotFound, "NotFoundException", fmt.Sprintf("Ticker not running: %s", botID))
+	}
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "TickerException", fmt.Sprintf("Failed to get latency: %v", err))
+	}
+
+	res := TickerLatencyResponse{
+		UserID:      latency.UserID,
+		BotID:       latency.BotID,
+		ThresholdMs: milliseconds(latency.Threshold),
+		Feed:        newLatencyStatsResponse(latency.Feed),
+		Publish:     newLatencyStatsResponse(latency.Publish),
+		Total:       newLatencyStatsResponse(latency.Total),
+		Instruments: make([]InstrumentLatencyResponse, 0, len(latency.Instruments)),
+	}
+	for _, inst := range latency.Instruments {
+		item := InstrumentLatencyResponse{
+			Instrument: inst.Instrument,
+			Token:      inst.Token,
+			LastMs:     milliseconds(inst.Last),
+			Total:      newLatencyStatsResponse(inst.Total),
+			Slow:       inst.Slow,
+		}
+		if inst.Slow {
+			res.Slow++
+			item.SlowSince = inst.SlowSince.Format(time.RFC3339)
+		}
+		res.Instruments = append(res.Instruments, item)
+	}
+
+	return response.SuccessResponse(c, res)
+}
+
+func newLatencyStatsResponse(stats service.LatencyStats) LatencyStatsResponse {
+	return LatencyStatsResponse{
+		Count: stats.Count,
+		P50Ms: milliseconds(stats.P50),
+		P90Ms: milliseconds(stats.P90),
+		P99Ms: milliseconds(stats.P99),
+		MaxMs: milliseconds(stats.Max),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
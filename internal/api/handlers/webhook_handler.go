@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nsvirk/moneybotstds/internal/models"
+	"github.com/nsvirk/moneybotstds/internal/service"
+	"github.com/nsvirk/moneybotstds/pkg/response"
+)
+
+// Number of delivery attempts returned by the deliveries route
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 500
+)
+
+// CreateWebhookRequest is the request body for the POST /webhooks route
+type CreateWebhookRequest struct {
+	URL    string   `json:"url"`
+	BotID  string   `json:"bot_id"`
+	Events []string `json:"events"`
+}
+
+// WebhookResponse is a webhook in the /webhooks responses. The secret is only
+// returned when the webhook is created
+type WebhookResponse struct {
+	ID        uint32   `json:"id"`
+	URL       string   `json:"url"`
+	BotID     string   `json:"bot_id,omitempty"`
+	Events    []string `json:"events"`
+	Secret    string   `json:"secret,omitempty"`
+	CreatedAt string   `json:"created_at"`
+}
+
+// WebhookDeliveryResponse is a delivery attempt in the deliveries response
+type WebhookDeliveryResponse struct {
+	DeliveryID  string `json:"delivery_id"`
+	BotID       string `json:"bot_id"`
+	Event       string `json:"event"`
+	Attempt     int    `json:"attempt"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Success     bool   `json:"success"`
+	DurationMs  int64  `json:"duration_ms"`
+	AttemptedAt string `json:"attempted_at"`
+}
+
+// WebhookHandler is the handler for the /webhooks routes
+type WebhookHandler struct {
+	webhookService *service.WebhookService
+}
+
+// NewWebhookHandler creates a new WebhookHandler
+func NewWebhookHandler(webhookService *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{webhookService: webhookService}
+}
+
+// CreateWebhook registers a webhook for the user
+func (h *WebhookHandler) CreateWebhook(c echo.Context) error {
+	var req CreateWebhookRequest
+	if err := c.Bind(&req); err != nil {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", "Invalid request body")
+	}
+
+	if req.URL == "" {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", "`url` is required")
+	}
+
+	userID := c.Get("userID").(string)
+
+	webhook, err := h.webhookService.CreateWebhook(userID, req.BotID, req.URL, req.Events)
+	if errors.Is(err, service.ErrInvalidWebhook) {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", fmt.Sprintf("Failed to create webhook: %v", err))
+	}
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to create webhook: %v", err))
+	}
+
+	res := newWebhookResponse(*webhook)
+	res.Secret = webhook.Secret
+
+	return response.SuccessResponse(c, res)
+}
+
+// ListWebhooks lists the webhooks of the user
+func (h *WebhookHandler) ListWebhooks(c echo.Context) error {
+	userID := c.Get("userID").(string)
+
+	webhooks, err := h.webhookService.ListWebhooks(userID)
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to get webhooks: %v", err))
+	}
+
+	results := make([]WebhookResponse, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		results = append(results, newWebhookResponse(webhook))
+	}
+
+	return response.SuccessResponse(c, results)
+}
+
+// DeleteWebhook deletes a webhook of the user
+func (h *WebhookHandler) DeleteWebhook(c echo.Context) error {
+	id, err := webhookID(c)
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", err.Error())
+	}
+
+	userID := c.Get("userID").(string)
+
+	err = h.webhookService.DeleteWebhook(userID, id)
+	if errors.Is(err, service.ErrWebhookNotFound) {
+		return response.ErrorResponse(c, http.StatusNotFound, "NotFoundException", fmt.Sprintf("Webhook not found: %d", id))
+	}
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to delete webhook: %v", err))
+	}
+
+	return response.SuccessResponse(c, map[string]uint32{"id": id})
+}
+
+// ListDeliveries lists the latest delivery attempts of a webhook of the user
+func (h *WebhookHandler) ListDeliveries(c echo.Context) error {
+	id, err := webhookID(c)
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusBadRequest, "InputException", err.Error())
+	}
+
+	limit := defaultDeliveriesLimit
+	if l := c.QueryParam("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			return response.ErrorResponse(c, http.StatusBadRequest, "InputException", "`limit` must be a positive number")
+		}
+		limit = min(n, maxDeliveriesLimit)
+	}
+
+	userID := c.Get("userID").(string)
+
+	deliveries, err := h.webhookService.ListDeliveries(userID, id, limit)
+	if errors.Is(err, service.ErrWebhookNotFound) {
+		return response.ErrorResponse(c, http.StatusNotFound, "NotFoundException", fmt.Sprintf("Webhook not found: %d", id))
+	}
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", fmt.Sprintf("Failed to get deliveries: %v", err))
+	}
+
+	results := make([]WebhookDeliveryResponse, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		results = append(results, WebhookDeliveryResponse{
+			DeliveryID:  delivery.DeliveryID,
+			BotID:       delivery.BotID,
+			Event:       delivery.Event,
+			Attempt:     delivery.Attempt,
+			StatusCode:  delivery.StatusCode,
+			Error:       delivery.Error,
+			Success:     delivery.Success,
+			DurationMs:  delivery.DurationMs,
+			AttemptedAt: delivery.AttemptedAt.Format(time.RFC3339),
+		})
+	}
+
+	return response.SuccessResponse(c, results)
+}
+
+func webhookID(c echo.Context) (uint32, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid webhook id: %s", c.Param("id"))
+	}
+	return uint32(id), nil
+}
+
+func newWebhookResponse(webhook models.Webhook) WebhookResponse {
+	return WebhookResponse{
+		ID:        webhook.ID,
+		URL:       webhook.URL,
+		BotID:     webhook.BotID,
+		Events:    service.WebhookEventsOf(&webhook),
+		CreatedAt: webhook.CreatedAt.Format(time.RFC3339),
+	}
+}
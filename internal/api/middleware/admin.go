@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nsvirk/moneybotstds/pkg/response"
+)
+
+// AdminAuthMiddleware creates a new authorization middleware for the admin
+// routes, accepting `Authorization: admin <admin_token>`
+func AdminAuthMiddleware(adminToken string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token, ok := strings.CutPrefix(c.Request().Header.Get("Authorization"), "admin ")
+			if !ok {
+				return response.ErrorResponse(c, http.StatusUnauthorized, "AuthorizationException", "Missing admin Authorization header")
+			}
+
+			if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+				return response.ErrorResponse(c, http.StatusUnauthorized, "AuthorizationException", "Invalid admin token")
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nsvirk/moneybotstds/internal/models"
+	"github.com/nsvirk/moneybotstds/internal/service"
+)
+
+// Largest request body read for the audit summary
+const auditMaxBody = 1 << 20
+
+// AuditMiddleware records the requests of the routes it is used on in the
+// audit log, as the action `<method> <route>`, with the user, bot, request
+// summary, remote IP, outcome and latency. Reads by users are not recorded.
+// For user routes it must run after AuthMiddleware, for admin routes the user
+// and bot are taken from the `user_id` and `bot_id` path params
+func AuditMiddleware(auditService *service.AuditService, actor string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if actor == service.AuditActorUser && (req.Method == http.MethodGet || req.Method == http.MethodHead) {
+				return next(c)
+			}
+
+			start := time.Now()
+
+			// Read the start of the body and restore the whole body for the
+			// handler
+			var body []byte
+			if req.Body != nil {
+				body, _ = io.ReadAll(io.LimitReader(req.Body, auditMaxBody))
+				req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), req.Body))
+			}
+
+			handlerErr := next(c)
+			if handlerErr != nil {
+				c.Error(handlerErr)
+			}
+
+			auditLog := &models.AuditLog{
+				Timestamp: start,
+				Actor:     actor,
+				UserID:    auditUserID(c, actor),
+				BotID:     auditBotID(c, body),
+				Action:    req.Method + " " + c.Path(),
+				Method:    req.Method,
+				Path:      req.URL.Path,
+				Summary:   service.SummarizeRequestBody(body),
+				RemoteIP:  c.RealIP(),
+				Status:    c.Response().Status,
+				LatencyMs: time.Since(start).Milliseconds(),
+			}
+			if scheme, ok := c.Get("authScheme").(string); ok {
+				auditLog.AuthScheme = scheme
+			}
+			if auditLog.Status < 400 {
+				auditLog.Outcome = "success"
+			} else {
+				auditLog.Outcome = "failure"
+				auditLog.Error = auditErrorMessage(c)
+				if auditLog.Error == "" && handlerErr != nil {
+					auditLog.Error = handlerErr.Error()
+				}
+			}
+			auditService.Record(auditLog)
+
+			// The error was handled above
+			return nil
+		}
+	}
+}
+
+func auditUserID(c echo.Context, actor string) string {
+	if actor == service.AuditActorAdmin {
+		return c.Param("user_id")
+	}
+	userID, _ := c.Get("userID").(string)
+	return userID
+}
+
+func auditBotID(c echo.Context, body []byte) string {
+	if botID := c.Param("bot_id"); botID != "" {
+		return botID
+	}
+	var req struct {
+		BotID string `json:"bot_id"`
+	}
+	json.Unmarshal(body, &req)
+	return req.BotID
+}
+
+// auditErrorMessage returns the error of the response, set in the context by
+// response.ErrorResponse
+func auditErrorMessage(c echo.Context) string {
+	message, _ := c.Get("errorMessage").(string)
+	return message
+}
@@ -1,15 +1,29 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/labstack/echo/v4"
+	"github.com/nsvirk/moneybotstds/internal/kite"
+	"github.com/nsvirk/moneybotstds/internal/service"
 	"github.com/nsvirk/moneybotstds/pkg/response"
 )
 
-// AuthMiddleware creates a new authorization middleware
-func AuthMiddleware() echo.MiddlewareFunc {
+// Authorization schemes
+const (
+	// AuthSchemeEnctoken is `Authorization: <user_id>:<enctoken>`
+	AuthSchemeEnctoken = "enctoken"
+	// AuthSchemeAPIKey is `Authorization: token <api_key>:<api_secret>`
+	AuthSchemeAPIKey = "api_key"
+)
+
+// AuthMiddleware creates a new authorization middleware accepting either a Kite
+// enctoken or a service-issued API key. It sets `userID`, `enctoken` (empty for
+// an API key), `authScheme` and `scopes` in the context
+func AuthMiddleware(verifier *kite.EnctokenVerifier, apiKeyService *service.APIKeyService) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			auth := c.Request().Header.Get("Authorization")
@@ -17,50 +31,93 @@ func AuthMiddleware() echo.MiddlewareFunc {
 				return response.ErrorResponse(c, http.StatusUnauthorized, "AuthorizationException", "Missing Authorization header")
 			}
 
-			parts := strings.SplitN(auth, ":", 2)
-			if len(parts) != 2 {
-				return response.ErrorResponse(c, http.StatusUnauthorized, "AuthorizationException", "Invalid Authorization header format")
+			if credentials, ok := strings.CutPrefix(auth, "token "); ok {
+				return authenticateAPIKey(c, next, credentials, apiKeyService)
 			}
 
-			userID, enctoken := parts[0], parts[1]
+			return authenticateEnctoken(c, next, auth, verifier)
+		}
+	}
+}
 
-			// Verify the enctoken
-			valid, err := verifyEnctoken(enctoken)
-			if err != nil || !valid {
-				return response.ErrorResponse(c, http.StatusUnauthorized, "AuthorizationException", "Invalid or expired session")
-			}
+func authenticateEnctoken(c echo.Context, next echo.HandlerFunc, auth string, verifier *kite.EnctokenVerifier) error {
+	parts := strings.SplitN(auth, ":", 2)
+	if len(parts) != 2 {
+		return response.ErrorResponse(c, http.StatusUnauthorized, "AuthorizationException", "Invalid Authorization header format")
+	}
 
-			// Add session data to context for use in handlers
-			c.Set("userID", userID)
-			c.Set("enctoken", enctoken)
+	userID, enctoken := parts[0], parts[1]
 
-			// Get from the context to verify that the data was set
-			userID = c.Get("userID").(string)
-			enctoken = c.Get("enctoken").(string)
+	// Verify the enctoken
+	profile, err := verifier.Verify(c.Request().Context(), enctoken)
+	if errors.Is(err, kite.ErrInvalidSession) {
+		return response.ErrorResponse(c, http.StatusUnauthorized, "AuthorizationException", "Invalid or expired session")
+	}
+	if err != nil {
+		return response.ErrorResponse(c, http.StatusServiceUnavailable, "NetworkException", "Unable to verify session")
+	}
 
-			return next(c)
-		}
+	// The enctoken must belong to the claimed user
+	if profile.UserID != userID {
+		return response.ErrorResponse(c, http.StatusUnauthorized, "AuthorizationException", "Session does not belong to user")
 	}
+
+	// Add session data to context for use in handlers
+	c.Set("userID", userID)
+	c.Set("enctoken", enctoken)
+	c.Set("profile", profile)
+	c.Set("authScheme", AuthSchemeEnctoken)
+	c.Set("scopes", service.AllScopes)
+
+	return next(c)
 }
 
-// verifyEnctoken verifies the enctoken
-func verifyEnctoken(enctoken string) (bool, error) {
+func authenticateAPIKey(c echo.Context, next echo.HandlerFunc, credentials string, apiKeyService *service.APIKeyService) error {
+	parts := strings.SplitN(credentials, ":", 2)
+	if len(parts) != 2 {
+		return response.ErrorResponse(c, http.StatusUnauthorized, "AuthorizationException", "Invalid Authorization header format")
+	}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", "https://kite.zerodha.com/oms/user/profile", nil)
+	key, err := apiKeyService.Verify(parts[0], parts[1])
+	if errors.Is(err, service.ErrInvalidAPIKey) {
+		return response.ErrorResponse(c, http.StatusUnauthorized, "AuthorizationException", "Invalid api key or secret")
+	}
 	if err != nil {
-		return false, err
+		return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", "Unable to verify api key")
 	}
-	req.Header.Add("Authorization", "enctoken "+enctoken)
-	req.Header.Add("X-Kite-Version", "3")
-	req.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 Safari/537.36")
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Add("Host", "kite.zerodha.com")
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return false, err
+	// Tickers use the enctoken the user registered
+	c.Set("userID", key.UserID)
+	c.Set("enctoken", "")
+	c.Set("authScheme", AuthSchemeAPIKey)
+	c.Set("scopes", service.APIKeyScopes(key))
+
+	return next(c)
+}
+
+// RequireScope rejects requests whose credentials were not granted scope.
+// It must run after AuthMiddleware
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			scopes, _ := c.Get("scopes").([]string)
+			if !slices.Contains(scopes, scope) {
+				return response.ErrorResponse(c, http.StatusForbidden, "PermissionException", "Missing scope: "+scope)
+			}
+			return next(c)
+		}
 	}
+}
 
-	return resp.StatusCode == 200, nil
+// RequireEnctokenAuth rejects requests not authenticated with an enctoken, for
+// routes that manage credentials. It must run after AuthMiddleware
+func RequireEnctokenAuth() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Get("authScheme") != AuthSchemeEnctoken {
+				return response.ErrorResponse(c, http.StatusForbidden, "PermissionException", "This route requires enctoken authorization")
+			}
+			return next(c)
+		}
+	}
 }
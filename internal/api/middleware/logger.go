@@ -2,23 +2,68 @@
 package middleware
 
 import (
+	"log/slog"
+
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	"github.com/labstack/gommon/log"
+	"github.com/nsvirk/moneybotstds/internal/logger"
 )
 
-// LoggerMiddleware configures and adds logger middleware to the Echo instance
+// LoggerMiddleware configures and adds logger middleware to the Echo instance.
+// Each request gets an ID, returned in the X-Request-Id header and added to
+// the records logged with the request context, and is logged to stdout
 func LoggerMiddleware(e *echo.Echo) {
-	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
-		Format: "${time_rfc3339}: ip=${remote_ip}, req=${method}, uri=${uri}, status=${status}\n",
+	e.Use(middleware.RequestIDWithConfig(middleware.RequestIDConfig{
+		RequestIDHandler: func(c echo.Context, requestID string) {
+			ctx := logger.ContextWithAttrs(c.Request().Context(), slog.String(logger.KeyRequestID, requestID))
+			c.SetRequest(c.Request().WithContext(ctx))
+		},
 	}))
 
+	requestLogger := logger.Stdout()
+	e.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		LogRemoteIP: true,
+		LogMethod:   true,
+		LogURI:      true,
+		LogStatus:   true,
+		LogLatency:  true,
+		LogError:    true,
+		HandleError: true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			attrs := []slog.Attr{
+				slog.String("ip", v.RemoteIP),
+				slog.String("method", v.Method),
+				slog.String("uri", v.URI),
+				slog.Int("status", v.Status),
+				slog.Int64("latency_ms", v.Latency.Milliseconds()),
+			}
+			if userID, ok := c.Get("userID").(string); ok {
+				attrs = append(attrs, slog.String(logger.KeyUserID, userID))
+			}
+
+			level := slog.LevelInfo
+			if v.Error != nil {
+				attrs = append(attrs, slog.String("error", v.Error.Error()))
+			}
+			if v.Status >= 500 {
+				level = slog.LevelError
+			}
+			requestLogger.LogAttrs(c.Request().Context(), level, "Request", attrs...)
+			return nil
+		},
+	}))
 }
 
 // RecoverMiddleware configures and adds recover middleware to the Echo instance
 func RecoverMiddleware(e *echo.Echo) {
 	e.Use(middleware.RecoverWithConfig(middleware.RecoverConfig{
 		StackSize: 1 << 10, // 1 KB
-		LogLevel:  log.ERROR,
+		LogErrorFunc: func(c echo.Context, err error, stack []byte) error {
+			slog.Default().LogAttrs(c.Request().Context(), slog.LevelError, "Recovered from panic",
+				slog.String("error", err.Error()),
+				slog.String("stack", string(stack)),
+			)
+			return err
+		},
 	}))
 }
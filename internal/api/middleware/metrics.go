@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nsvirk/moneybotstds/internal/metrics"
+	"github.com/nsvirk/moneybotstds/pkg/response"
+)
+
+// MetricsMiddleware adds the HTTP request metrics middleware to the Echo
+// instance. Requests are labelled by route, not by path
+func MetricsMiddleware(e *echo.Echo) {
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			method := c.Request().Method
+
+			metrics.HTTPRequests.WithLabelValues(method, route, strconv.Itoa(c.Response().Status)).Inc()
+			metrics.HTTPRequestSeconds.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+
+			// The error was handled above
+			return nil
+		}
+	})
+}
+
+// MetricsAuthMiddleware creates a new authorization middleware for /metrics
+// accepting `Authorization: Bearer <metrics_token>`
+func MetricsAuthMiddleware(metricsToken string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			expected := "Bearer " + metricsToken
+			if subtle.ConstantTimeCompare([]byte(c.Request().Header.Get("Authorization")), []byte(expected)) != 1 {
+				return response.ErrorResponse(c, http.StatusUnauthorized, "AuthorizationException", "Invalid metrics token")
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nsvirk/moneybotstds/internal/service"
+	"github.com/nsvirk/moneybotstds/pkg/response"
+)
+
+// RateLimitMiddleware limits the calls of each user to the routes it is used
+// on to the calls per minute of their quota, counted together. It must run
+// after AuthMiddleware
+func RateLimitMiddleware(quotaService *service.QuotaService) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userID := c.Get("userID").(string)
+
+			retryAfter, err := quotaService.AllowCall(userID)
+			if errors.Is(err, service.ErrQuotaExceeded) {
+				c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				return response.ErrorResponse(c, http.StatusTooManyRequests, "QuotaExceeded", err.Error())
+			}
+			if err != nil {
+				return response.ErrorResponse(c, http.StatusInternalServerError, "DatabaseException", "Unable to get quota")
+			}
+
+			return next(c)
+		}
+	}
+}
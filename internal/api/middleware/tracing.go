@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nsvirk/moneybotstds/internal/logger"
+	"github.com/nsvirk/moneybotstds/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// TracingMiddleware adds the tracing middleware to the Echo instance. Each
+// request gets a span named by its route, continuing the trace of the caller
+// if it sent a `traceparent` header
+func TracingMiddleware(e *echo.Echo) {
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+
+			ctx, span := tracing.StartServer(ctx, req.Method+" "+route,
+				semconv.HTTPRequestMethodKey.String(req.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(req.URL.Path),
+			)
+			defer span.End()
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if requestID := c.Response().Header().Get(echo.HeaderXRequestID); requestID != "" {
+				span.SetAttributes(attribute.String(logger.KeyRequestID, requestID))
+			}
+			if userID, ok := c.Get("userID").(string); ok {
+				span.SetAttributes(attribute.String(logger.KeyUserID, userID))
+			}
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+
+			// The error was handled above
+			return nil
+		}
+	})
+}
@@ -5,27 +5,141 @@ import (
 	"github.com/nsvirk/moneybotstds/internal/api/handlers"
 	"github.com/nsvirk/moneybotstds/internal/api/middleware"
 	"github.com/nsvirk/moneybotstds/internal/config"
+	"github.com/nsvirk/moneybotstds/internal/kite"
 	"github.com/nsvirk/moneybotstds/internal/service"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"gorm.io/gorm"
 )
 
-func InitRoutes(e *echo.Echo, cfg *config.Config, db *gorm.DB, tickerService *service.TickerService) {
+func InitRoutes(e *echo.Echo, cfg *config.Config, db *gorm.DB, enctokenVerifier *kite.EnctokenVerifier, tickerService *service.TickerService, webhookService *service.WebhookService, quotaService *service.QuotaService, healthService *service.HealthService, instrumentService *service.InstrumentService, instrumentCache *service.InstrumentCache) {
+
+	// Client IPs of audit logs, X-Forwarded-For is only trusted from the
+	// configured proxies
+	if len(cfg.TrustedProxies) > 0 {
+		options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+		for _, cidr := range cfg.TrustedProxies {
+			options = append(options, echo.TrustIPRange(cidr))
+		}
+		e.IPExtractor = echo.ExtractIPFromXFFHeader(options...)
+	} else {
+		e.IPExtractor = echo.ExtractIPDirect()
+	}
 
 	middleware.LoggerMiddleware(e)
+	middleware.TracingMiddleware(e)
 	middleware.RecoverMiddleware(e)
+	middleware.MetricsMiddleware(e)
 
 	// Create a group for all API routes
 	api := e.Group("")
 
+	// Authorization shared by all authenticated routes
+	apiKeyService := service.NewAPIKeyService(db)
+	authMiddleware := middleware.AuthMiddleware(enctokenVerifier, apiKeyService)
+
+	// Audit log of the actions of users and operators
+	auditService := service.NewAuditService(db)
+	auditMiddleware := middleware.AuditMiddleware(auditService, service.AuditActorUser)
+
 	// Index route
-	indexHandler := handlers.NewIndexHandler(cfg)
+	indexHandler := handlers.NewIndexHandler(cfg, instrumentService)
 	e.GET("/", indexHandler.Index)
 
+	// Health routes
+	healthHandler := handlers.NewHealthHandler(healthService)
+	e.GET("/healthz", healthHandler.Healthz)
+	e.GET("/readyz", healthHandler.Readyz)
+
+	// Metrics route, protected if a metrics token is configured
+	metricsHandler := echo.WrapHandler(promhttp.Handler())
+	if cfg.MetricsToken != "" {
+		e.GET("/metrics", metricsHandler, middleware.MetricsAuthMiddleware(cfg.MetricsToken))
+	} else {
+		e.GET("/metrics", metricsHandler)
+	}
+
+	// /session route
+	sessionHandler := handlers.NewSessionHandler(tickerService)
+	sessionGroup := api.Group("/session")
+	sessionGroup.Use(authMiddleware, middleware.RequireEnctokenAuth(), auditMiddleware)
+	sessionGroup.POST("", sessionHandler.Register)
+	sessionGroup.DELETE("", sessionHandler.Remove)
+
+	// /keys route
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+	keysGroup := api.Group("/keys")
+	keysGroup.Use(authMiddleware, middleware.RequireEnctokenAuth(), auditMiddleware)
+	keysGroup.POST("", apiKeyHandler.CreateAPIKey)
+	keysGroup.GET("", apiKeyHandler.ListAPIKeys)
+	keysGroup.DELETE("/:api_key", apiKeyHandler.RevokeAPIKey)
+
+	// /me route
+	quotaHandler := handlers.NewQuotaHandler(quotaService, tickerService)
+	meGroup := api.Group("/me")
+	meGroup.Use(authMiddleware, middleware.RequireScope(service.ScopeTicksRead))
+	meGroup.GET("/quota", quotaHandler.GetQuota)
+
+	// /audit route
+	auditHandler := handlers.NewAuditHandler(auditService)
+	auditGroup := api.Group("/audit")
+	auditGroup.Use(authMiddleware, middleware.RequireScope(service.ScopeTicksRead))
+	auditGroup.GET("", auditHandler.UserAuditLogs)
+
+	// /logs route
+	logService := service.NewLogService(db)
+	logHandler := handlers.NewLogHandler(logService)
+	e.Server.RegisterOnShutdown(logHandler.Close)
+	logsGroup := api.Group("/logs")
+	logsGroup.Use(authMiddleware, middleware.RequireScope(service.ScopeTicksRead))
+	logsGroup.GET("/ticker", logHandler.UserTickerLogs)
+	logsGroup.GET("/ticker/stream", logHandler.StreamTickerLogs)
+
+	// /tickers route
+	tickerHandler := handlers.NewTickerHandler(tickerService)
+	tickersGroup := api.Group("/tickers")
+	tickersGroup.Use(authMiddleware, middleware.RequireScope(service.ScopeTicksRead))
+	tickersGroup.GET("/:bot_id/latency", tickerHandler.Latency)
+
+	// /webhooks route
+	webhookHandler := handlers.NewWebhookHandler(webhookService)
+	webhooksGroup := api.Group("/webhooks")
+	webhooksGroup.Use(authMiddleware, middleware.RequireEnctokenAuth(), auditMiddleware)
+	webhooksGroup.POST("", webhookHandler.CreateWebhook)
+	webhooksGroup.GET("", webhookHandler.ListWebhooks)
+	webhooksGroup.DELETE("/:id", webhookHandler.DeleteWebhook)
+	webhooksGroup.GET("/:id/deliveries", webhookHandler.ListDeliveries)
+
 	// /publish route
-	publishHandler := handlers.NewPublishHandler(db, tickerService)
+	publishHandler := handlers.NewPublishHandler(db, tickerService, instrumentCache)
 	publishGroup := api.Group("/publish")
-	publishGroup.Use(middleware.AuthMiddleware())
-	publishGroup.POST("/start", publishHandler.StartPublishing)
-	publishGroup.POST("/stop", publishHandler.StopPublishing)
+	publishGroup.Use(authMiddleware, auditMiddleware, middleware.RateLimitMiddleware(quotaService))
+	publishGroup.POST("/start", publishHandler.StartPublishing, middleware.RequireScope(service.ScopePublishStart))
+	publishGroup.POST("/stop", publishHandler.StopPublishing, middleware.RequireScope(service.ScopePublishStop))
+	publishGroup.POST("/resume", publishHandler.ResumePublishing, middleware.RequireScope(service.ScopePublishStart))
+
+	// /instruments route
+	instrumentHandler := handlers.NewInstrumentHandler(instrumentService)
+	instrumentsGroup := api.Group("/instruments")
+	instrumentsGroup.Use(authMiddleware, middleware.RequireScope(service.ScopeTicksRead))
+	instrumentsGroup.GET("/search", instrumentHandler.Search)
+	instrumentsGroup.GET("/:exchange/:tradingsymbol", instrumentHandler.Lookup)
+
+	// /admin route, only when an admin token is configured
+	if cfg.AdminToken != "" {
+		adminHandler := handlers.NewAdminHandler(tickerService, quotaService, logService)
+		adminGroup := api.Group("/admin")
+		adminGroup.Use(middleware.AdminAuthMiddleware(cfg.AdminToken), middleware.AuditMiddleware(auditService, service.AuditActorAdmin))
+		adminGroup.GET("/tickers", adminHandler.ListTickers)
+		adminGroup.POST("/tickers/:user_id/:bot_id/stop", adminHandler.StopTicker)
+		adminGroup.GET("/tickers/:user_id/:bot_id/latency", tickerHandler.AdminLatency)
+		adminGroup.POST("/users/:user_id/stop", adminHandler.StopUserTickers)
+		adminGroup.GET("/users/:user_id/quota", adminHandler.GetQuota)
+		adminGroup.PUT("/users/:user_id/quota", adminHandler.SetQuota)
+		adminGroup.GET("/logs/ticker", logHandler.AdminTickerLogs)
+		adminGroup.GET("/logs/app", adminHandler.AppLogs)
+		adminGroup.GET("/audit", auditHandler.AdminAuditLogs)
+		adminGroup.GET("/instruments/cache", instrumentHandler.CacheStats)
+		adminGroup.POST("/instruments/cache/reload", instrumentHandler.ReloadCache)
+	}
 
 }
@@ -2,7 +2,11 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -15,6 +19,63 @@ type Config struct {
 	RedisPort        string
 	RedisPassword    string
 	ServerPort       string
+	RiskFreeRate     float64
+
+	InstrumentsSource    string
+	InstrumentsRefreshAt string
+	InstrumentsMaxAge    time.Duration
+
+	KiteProfileURL       string
+	KiteProfileTimeout   time.Duration
+	AuthCacheTTL         time.Duration
+	AuthNegativeCacheTTL time.Duration
+
+	// Tick latency above which instruments are flagged slow, 0 disables it
+	TickLatencyThreshold time.Duration
+
+	// Stale feed detection, FeedRecovery is off, resubscribe or reconnect and
+	// a FeedCheckInterval of 0 disables it
+	FeedCheckInterval        time.Duration
+	FeedInstrumentStaleAfter time.Duration
+	FeedConnectionStaleAfter time.Duration
+	FeedRecovery             string
+
+	// CSV file of market holidays imported into the calendar on startup
+	HolidaysFile string
+
+	CredentialsKeys string
+	AdminToken      string
+	ShutdownDrain   time.Duration
+	MetricsToken    string
+
+	// Proxies trusted to set X-Forwarded-For, none takes the address of the
+	// connection as the client IP
+	TrustedProxies []*net.IPNet
+
+	// Logging, LogLevel is debug, info, warn, error or fatal and LogFormat
+	// is json or text
+	LogLevel         string
+	LogFormat        string
+	LogBufferSize    int
+	LogBatchSize     int
+	LogFlushInterval time.Duration
+
+	// Retention of the logs tables, see service.ParseRetentionRules
+	LogRetention     string
+	LogPruneInterval time.Duration
+	LogArchiveDir    string
+
+	// Tracing, TracingExporter is otlp, stdout or empty to disable it
+	TracingExporter        string
+	TracingEndpoint        string
+	TracingSampleRatio     float64
+	TracingTickSampleRatio float64
+
+	// Default quotas of users without their own, 0 is unlimited
+	QuotaMaxBots              int
+	QuotaMaxInstrumentsPerBot int
+	QuotaMaxInstruments       int
+	QuotaMaxCallsPerMinute    int
 }
 
 func Load() (*Config, error) {
@@ -29,6 +90,102 @@ func Load() (*Config, error) {
 		RedisPort:        getEnv("MB_TDS_REDIS_PORT", ""),
 		RedisPassword:    getEnv("MB_TDS_REDIS_PASSWORD", ""),
 		ServerPort:       getEnv("MB_TDS_SERVER_PORT", ""),
+		LogLevel:         getEnv("MB_TDS_LOG_LEVEL", "info"),
+		LogFormat:        getEnv("MB_TDS_LOG_FORMAT", "json"),
+		LogRetention:     getEnv("MB_TDS_LOG_RETENTION", "off"),
+		LogArchiveDir:    getEnv("MB_TDS_LOG_ARCHIVE_DIR", ""),
+		TracingExporter:  getEnv("MB_TDS_TRACING_EXPORTER", ""),
+		TracingEndpoint:  getEnv("MB_TDS_TRACING_ENDPOINT", ""),
+		FeedRecovery:     getEnv("MB_TDS_FEED_RECOVERY", "off"),
+		HolidaysFile:     getEnv("MB_TDS_HOLIDAYS_FILE", ""),
+
+		InstrumentsSource:    getEnv("MB_TDS_INSTRUMENTS_SOURCE", "https://api.kite.trade/instruments"),
+		InstrumentsRefreshAt: getEnv("MB_TDS_INSTRUMENTS_REFRESH_AT", "08:30"),
+
+		KiteProfileURL: getEnv("MB_TDS_KITE_PROFILE_URL", "https://kite.zerodha.com/oms/user/profile"),
+
+		CredentialsKeys: getEnv("MB_TDS_CREDENTIALS_KEYS", ""),
+		AdminToken:      getEnv("MB_TDS_ADMIN_TOKEN", ""),
+		MetricsToken:    getEnv("MB_TDS_METRICS_TOKEN", ""),
+	}
+
+	var err error
+	if config.RiskFreeRate, err = getEnvFloat("MB_TDS_RISK_FREE_RATE", "0.07"); err != nil {
+		return nil, err
+	}
+	if config.KiteProfileTimeout, err = getEnvDuration("MB_TDS_KITE_PROFILE_TIMEOUT", "5s"); err != nil {
+		return nil, err
+	}
+	if config.AuthCacheTTL, err = getEnvDuration("MB_TDS_AUTH_CACHE_TTL", "5m"); err != nil {
+		return nil, err
+	}
+	if config.AuthNegativeCacheTTL, err = getEnvDuration("MB_TDS_AUTH_NEGATIVE_CACHE_TTL", "30s"); err != nil {
+		return nil, err
+	}
+
+	if config.InstrumentsMaxAge, err = getEnvDuration("MB_TDS_INSTRUMENTS_MAX_AGE", "36h"); err != nil {
+		return nil, err
+	}
+	if config.TickLatencyThreshold, err = getEnvDuration("MB_TDS_TICK_LATENCY_THRESHOLD", "2s"); err != nil {
+		return nil, err
+	}
+	if config.FeedCheckInterval, err = getEnvDuration("MB_TDS_FEED_CHECK_INTERVAL", "15s"); err != nil {
+		return nil, err
+	}
+	if config.FeedInstrumentStaleAfter, err = getEnvDuration("MB_TDS_FEED_INSTRUMENT_STALE_AFTER", "5m"); err != nil {
+		return nil, err
+	}
+	if config.FeedConnectionStaleAfter, err = getEnvDuration("MB_TDS_FEED_CONNECTION_STALE_AFTER", "30s"); err != nil {
+		return nil, err
+	}
+	if config.ShutdownDrain, err = getEnvDuration("MB_TDS_SHUTDOWN_DRAIN", "5s"); err != nil {
+		return nil, err
+	}
+	if config.LogBufferSize, err = getEnvInt("MB_TDS_LOG_BUFFER_SIZE", "10000"); err != nil {
+		return nil, err
+	}
+	if config.LogBatchSize, err = getEnvInt("MB_TDS_LOG_BATCH_SIZE", "200"); err != nil {
+		return nil, err
+	}
+	if config.LogFlushInterval, err = getEnvDuration("MB_TDS_LOG_FLUSH_INTERVAL", "1s"); err != nil {
+		return nil, err
+	}
+	if config.LogPruneInterval, err = getEnvDuration("MB_TDS_LOG_PRUNE_INTERVAL", "1h"); err != nil {
+		return nil, err
+	}
+	if config.TracingSampleRatio, err = getEnvFloat("MB_TDS_TRACING_SAMPLE_RATIO", "1"); err != nil {
+		return nil, err
+	}
+	if config.TracingTickSampleRatio, err = getEnvFloat("MB_TDS_TRACING_TICK_SAMPLE_RATIO", "0.001"); err != nil {
+		return nil, err
+	}
+	if config.QuotaMaxBots, err = getEnvInt("MB_TDS_QUOTA_MAX_BOTS", "3"); err != nil {
+		return nil, err
+	}
+	if config.QuotaMaxInstrumentsPerBot, err = getEnvInt("MB_TDS_QUOTA_MAX_INSTRUMENTS_PER_BOT", "3000"); err != nil {
+		return nil, err
+	}
+	if config.QuotaMaxInstruments, err = getEnvInt("MB_TDS_QUOTA_MAX_INSTRUMENTS", "9000"); err != nil {
+		return nil, err
+	}
+	if config.QuotaMaxCallsPerMinute, err = getEnvInt("MB_TDS_QUOTA_MAX_CALLS_PER_MINUTE", "30"); err != nil {
+		return nil, err
+	}
+
+	if config.TrustedProxies, err = getEnvCIDRs("MB_TDS_TRUSTED_PROXIES"); err != nil {
+		return nil, err
+	}
+
+	if config.InstrumentsRefreshAt != "off" {
+		if _, err := time.Parse("15:04", config.InstrumentsRefreshAt); err != nil {
+			return nil, fmt.Errorf("MB_TDS_INSTRUMENTS_REFRESH_AT must be HH:MM or off: %w", err)
+		}
+	}
+
+	switch config.FeedRecovery {
+	case "off", "resubscribe", "reconnect":
+	default:
+		return nil, fmt.Errorf("MB_TDS_FEED_RECOVERY must be off, resubscribe or reconnect")
 	}
 
 	if config.PostgresURL == "" {
@@ -65,3 +222,43 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+func getEnvDuration(key, defaultValue string) (time.Duration, error) {
+	value, err := time.ParseDuration(getEnv(key, defaultValue))
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a duration: %w", key, err)
+	}
+	return value, nil
+}
+
+func getEnvFloat(key, defaultValue string) (float64, error) {
+	value, err := strconv.ParseFloat(getEnv(key, defaultValue), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number: %w", key, err)
+	}
+	return value, nil
+}
+
+func getEnvInt(key, defaultValue string) (int, error) {
+	value, err := strconv.Atoi(getEnv(key, defaultValue))
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", key)
+	}
+	return value, nil
+}
+
+func getEnvCIDRs(key string) ([]*net.IPNet, error) {
+	var cidrs []*net.IPNet
+	for _, value := range strings.Split(getEnv(key, ""), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		_, cidr, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be comma separated CIDRs: %w", key, err)
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	return cidrs, nil
+}
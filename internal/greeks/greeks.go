@@ -0,0 +1,127 @@
+// Package greeks computes implied volatility and option greeks using the
+// Black-76 model, pricing options against the futures price of the underlying
+package greeks
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// Bounds and tolerance for the implied volatility solver
+	minVolatility = 0.0001
+	maxVolatility = 5.0
+	ivTolerance   = 1e-6
+	ivMaxIter     = 100
+
+	// Days in a year used for time to expiry and theta
+	daysPerYear = 365.0
+)
+
+// Greeks holds the implied volatility and greeks of an option
+type Greeks struct {
+	UnderlyingPrice float64
+	IV              float64 // annualised, as a fraction (0.15 = 15%)
+	Delta           float64
+	Gamma           float64
+	Theta           float64 // per calendar day
+	Vega            float64 // per 1% change in volatility
+}
+
+// Compute solves the implied volatility of an option from its price and
+// returns it with the greeks. isCall selects call or put, f is the underlying
+// futures price, k the strike, t the time to expiry in years and r the
+// annual risk-free rate. It returns false if no volatility reproduces the price
+func Compute(isCall bool, price, f, k, t, r float64) (Greeks, bool) {
+	if price <= 0 || f <= 0 || k <= 0 || t <= 0 {
+		return Greeks{}, false
+	}
+
+	iv, ok := ImpliedVolatility(isCall, price, f, k, t, r)
+	if !ok {
+		return Greeks{}, false
+	}
+
+	g := Greeks{UnderlyingPrice: f, IV: iv}
+
+	df := math.Exp(-r * t)
+	sqrtT := math.Sqrt(t)
+	d1 := (math.Log(f/k) + 0.5*iv*iv*t) / (iv * sqrtT)
+	d2 := d1 - iv*sqrtT
+
+	g.Gamma = df * pdf(d1) / (f * iv * sqrtT)
+	g.Vega = f * df * pdf(d1) * sqrtT / 100
+
+	decay := -f * df * pdf(d1) * iv / (2 * sqrtT)
+	if isCall {
+		g.Delta = df * cdf(d1)
+		g.Theta = (decay + r*f*df*cdf(d1) - r*k*df*cdf(d2)) / daysPerYear
+	} else {
+		g.Delta = -df * cdf(-d1)
+		g.Theta = (decay - r*f*df*cdf(-d1) + r*k*df*cdf(-d2)) / daysPerYear
+	}
+
+	return g, true
+}
+
+// Price returns the Black-76 price of an option
+func Price(isCall bool, f, k, t, r, sigma float64) float64 {
+	df := math.Exp(-r * t)
+	sqrtT := math.Sqrt(t)
+	d1 := (math.Log(f/k) + 0.5*sigma*sigma*t) / (sigma * sqrtT)
+	d2 := d1 - sigma*sqrtT
+
+	if isCall {
+		return df * (f*cdf(d1) - k*cdf(d2))
+	}
+	return df * (k*cdf(-d2) - f*cdf(-d1))
+}
+
+// ImpliedVolatility solves for the volatility that reproduces the option
+// price, using Newton-Raphson with a bisection fallback
+func ImpliedVolatility(isCall bool, price, f, k, t, r float64) (float64, bool) {
+	lo, hi := minVolatility, maxVolatility
+
+	// The price must lie between the bounds the model can produce
+	if price < Price(isCall, f, k, t, r, lo) || price > Price(isCall, f, k, t, r, hi) {
+		return 0, false
+	}
+
+	sigma := 0.3
+	for i := 0; i < ivMaxIter; i++ {
+		diff := Price(isCall, f, k, t, r, sigma) - price
+		if math.Abs(diff) < ivTolerance {
+			return sigma, true
+		}
+
+		// Narrow the bracket, price is increasing in sigma
+		if diff > 0 {
+			hi = sigma
+		} else {
+			lo = sigma
+		}
+
+		// Newton step, fall back to bisection if it leaves the bracket
+		vega := f * math.Exp(-r*t) * pdf((math.Log(f/k)+0.5*sigma*sigma*t)/(sigma*math.Sqrt(t))) * math.Sqrt(t)
+		next := sigma - diff/vega
+		if vega == 0 || math.IsNaN(next) || next <= lo || next >= hi {
+			next = (lo + hi) / 2
+		}
+		sigma = next
+	}
+
+	return sigma, true
+}
+
+// YearsToExpiry converts the time left to expiry into years
+func YearsToExpiry(d time.Duration) float64 {
+	return d.Hours() / (daysPerYear * 24)
+}
+
+func pdf(x float64) float64 {
+	return math.Exp(-0.5*x*x) / math.Sqrt(2*math.Pi)
+}
+
+func cdf(x float64) float64 {
+	return 0.5 * math.Erfc(-x/math.Sqrt2)
+}
@@ -0,0 +1,131 @@
+package greeks
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPrice(t *testing.T) {
+	tests := []struct {
+		name   string
+		isCall bool
+		f, k   float64
+		t, r   float64
+		sigma  float64
+		want   float64
+	}{
+		// Hull, Options, Futures and Other Derivatives, European futures option
+		{"at the money call", true, 20, 20, 4.0 / 12, 0.09, 0.25, 1.116641},
+		{"at the money put", false, 20, 20, 4.0 / 12, 0.09, 0.25, 1.116641},
+		{"out of the money call", true, 24000, 24500, 30.0 / 365, 0.07, 0.15, 211.693152},
+		{"in the money put", false, 24000, 24500, 30.0 / 365, 0.07, 0.15, 708.824699},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Price(tt.isCall, tt.f, tt.k, tt.t, tt.r, tt.sigma); math.Abs(got-tt.want) > 1e-4 {
+				t.Errorf("Price() = %.6f, want %.6f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImpliedVolatilityRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		isCall bool
+		f, k   float64
+		days   float64
+		sigma  float64
+	}{
+		{"at the money call", true, 24000, 24000, 30, 0.15},
+		{"at the money put", false, 24000, 24000, 30, 0.15},
+		{"out of the money call", true, 24000, 25000, 30, 0.18},
+		{"out of the money put", false, 24000, 23000, 30, 0.2},
+		{"in the money call", true, 24000, 23000, 7, 0.12},
+		{"near expiry", true, 70000, 71000, 1, 0.3},
+		{"high volatility", false, 500, 450, 90, 1.2},
+		{"low volatility", true, 100, 100, 60, 0.02},
+	}
+
+	const r = 0.07
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			years := tt.days / daysPerYear
+			price := Price(tt.isCall, tt.f, tt.k, years, r, tt.sigma)
+
+			iv, ok := ImpliedVolatility(tt.isCall, price, tt.f, tt.k, years, r)
+			if !ok || math.Abs(iv-tt.sigma) > 1e-4 {
+				t.Errorf("ImpliedVolatility() = %.6f, %v, want %.6f", iv, ok, tt.sigma)
+			}
+
+			g, ok := Compute(tt.isCall, price, tt.f, tt.k, years, r)
+			if !ok || math.Abs(g.IV-tt.sigma) > 1e-4 || g.UnderlyingPrice != tt.f {
+				t.Fatalf("Compute() = %+v, %v, want IV %.6f", g, ok, tt.sigma)
+			}
+			if tt.isCall && (g.Delta <= 0 || g.Delta >= 1) || !tt.isCall && (g.Delta >= 0 || g.Delta <= -1) {
+				t.Errorf("Delta = %.6f, out of range", g.Delta)
+			}
+			if g.Gamma <= 0 || g.Vega <= 0 {
+				t.Errorf("Gamma = %.6f, Vega = %.6f, want positive", g.Gamma, g.Vega)
+			}
+		})
+	}
+}
+
+func TestComputeParity(t *testing.T) {
+	// A call and a put of the same strike and volatility differ in delta by
+	// the discount factor
+	f, k, years, r, sigma := 24000.0, 24500.0, 30.0/daysPerYear, 0.07, 0.15
+
+	call, ok := Compute(true, Price(true, f, k, years, r, sigma), f, k, years, r)
+	if !ok {
+		t.Fatal("Compute() of the call failed")
+	}
+	put, ok := Compute(false, Price(false, f, k, years, r, sigma), f, k, years, r)
+	if !ok {
+		t.Fatal("Compute() of the put failed")
+	}
+
+	if got, want := call.Delta-put.Delta, math.Exp(-r*years); math.Abs(got-want) > 1e-6 {
+		t.Errorf("call delta - put delta = %.6f, want %.6f", got, want)
+	}
+	if math.Abs(call.Gamma-put.Gamma) > 1e-9 || math.Abs(call.Vega-put.Vega) > 1e-6 {
+		t.Errorf("Gamma %.9f/%.9f and Vega %.6f/%.6f differ", call.Gamma, put.Gamma, call.Vega, put.Vega)
+	}
+}
+
+func TestComputeInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		isCall bool
+		price  float64
+		f, k   float64
+		t      float64
+	}{
+		{"zero price", true, 0, 24000, 24000, 0.1},
+		{"zero futures price", true, 100, 0, 24000, 0.1},
+		{"zero strike", true, 100, 24000, 0, 0.1},
+		{"expired", true, 100, 24000, 24000, 0},
+		{"below intrinsic value", true, 100, 24000, 23000, 0.1},
+		{"above the futures price", true, 25000, 24000, 24000, 0.1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if g, ok := Compute(tt.isCall, tt.price, tt.f, tt.k, tt.t, 0.07); ok {
+				t.Errorf("Compute() = %+v, want no solution", g)
+			}
+		})
+	}
+}
+
+func TestYearsToExpiry(t *testing.T) {
+	if got := YearsToExpiry(365 * 24 * time.Hour); got != 1 {
+		t.Errorf("YearsToExpiry(365d) = %v, want 1", got)
+	}
+	if got := YearsToExpiry(73 * 24 * time.Hour); math.Abs(got-0.2) > 1e-12 {
+		t.Errorf("YearsToExpiry(73d) = %v, want 0.2", got)
+	}
+}
@@ -0,0 +1,172 @@
+// Package kite verifies Kite enctokens against the Kite profile endpoint
+package kite
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nsvirk/moneybotstds/internal/config"
+	"github.com/nsvirk/moneybotstds/internal/tracing"
+)
+
+// ErrInvalidSession is returned when Kite rejects an enctoken
+var ErrInvalidSession = errors.New("invalid or expired session")
+
+// KiteProfile is the verified Kite user of an enctoken
+type KiteProfile struct {
+	UserID        string `json:"user_id"`
+	UserName      string `json:"user_name"`
+	UserShortname string `json:"user_shortname"`
+}
+
+// EnctokenVerifier verifies enctokens against the Kite profile endpoint and
+// caches the outcome by a hash of the enctoken. Valid enctokens are cached for
+// the cache TTL, rejected ones for the negative cache TTL. Network and upstream
+// errors are not cached
+type EnctokenVerifier struct {
+	profileURL  string
+	client      *http.Client
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]verifierEntry
+	lastSweep time.Time
+}
+
+type verifierEntry struct {
+	profile   *KiteProfile // nil if the enctoken was rejected
+	expiresAt time.Time
+}
+
+// NewEnctokenVerifier creates a new EnctokenVerifier
+func NewEnctokenVerifier(cfg *config.Config) *EnctokenVerifier {
+	return &EnctokenVerifier{
+		profileURL:  cfg.KiteProfileURL,
+		client:      &http.Client{Timeout: cfg.KiteProfileTimeout},
+		ttl:         cfg.AuthCacheTTL,
+		negativeTTL: cfg.AuthNegativeCacheTTL,
+		entries:     make(map[string]verifierEntry),
+		lastSweep:   time.Now(),
+	}
+}
+
+// Verify returns the Kite profile of the enctoken, or ErrInvalidSession if Kite
+// rejects it
+func (v *EnctokenVerifier) Verify(ctx context.Context, enctoken string) (*KiteProfile, error) {
+	if entry, ok := v.get(tokenKey(enctoken)); ok {
+		if entry.profile == nil {
+			return nil, ErrInvalidSession
+		}
+		return entry.profile, nil
+	}
+
+	return v.Recheck(ctx, enctoken)
+}
+
+// Recheck verifies the enctoken with Kite bypassing the cache, and caches the
+// outcome
+func (v *EnctokenVerifier) Recheck(ctx context.Context, enctoken string) (*KiteProfile, error) {
+	key := tokenKey(enctoken)
+
+	ctx, span := tracing.Start(ctx, "kite.verify_enctoken")
+	profile, err := v.fetchProfile(ctx, enctoken)
+	tracing.End(span, err)
+	if errors.Is(err, ErrInvalidSession) {
+		v.set(key, verifierEntry{expiresAt: time.Now().Add(v.negativeTTL)})
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	v.set(key, verifierEntry{profile: profile, expiresAt: time.Now().Add(v.ttl)})
+	return profile, nil
+}
+
+// NegativeTTL returns how long rejected enctokens are cached
+func (v *EnctokenVerifier) NegativeTTL() time.Duration {
+	return v.negativeTTL
+}
+
+// tokenKey returns the cache key of an enctoken
+func tokenKey(enctoken string) string {
+	sum := sha256.Sum256([]byte(enctoken))
+	return hex.EncodeToString(sum[:])
+}
+
+func (v *EnctokenVerifier) get(key string) (verifierEntry, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	entry, ok := v.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return verifierEntry{}, false
+	}
+	return entry, true
+}
+
+func (v *EnctokenVerifier) set(key string, entry verifierEntry) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// Drop expired entries once per TTL
+	now := time.Now()
+	if now.Sub(v.lastSweep) > v.ttl {
+		for k, e := range v.entries {
+			if now.After(e.expiresAt) {
+				delete(v.entries, k)
+			}
+		}
+		v.lastSweep = now
+	}
+
+	v.entries[key] = entry
+}
+
+// fetchProfile gets the Kite profile of the enctoken
+func (v *EnctokenVerifier) fetchProfile(ctx context.Context, enctoken string) (*KiteProfile, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", v.profileURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", "enctoken "+enctoken)
+	req.Header.Add("X-Kite-Version", "3")
+	req.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/122.0.0.0 Safari/537.36")
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify enctoken: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		io.Copy(io.Discard, resp.Body)
+		return nil, ErrInvalidSession
+	case resp.StatusCode != http.StatusOK:
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("failed to verify enctoken: status %d", resp.StatusCode)
+	}
+
+	var profileResponse struct {
+		Data KiteProfile `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&profileResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode profile: %w", err)
+	}
+	if profileResponse.Data.UserID == "" {
+		return nil, ErrInvalidSession
+	}
+
+	return &profileResponse.Data, nil
+}
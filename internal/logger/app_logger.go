@@ -1,70 +1,59 @@
 package logger
 
 import (
-	"log"
-	"time"
+	"context"
+	"log/slog"
 
-	"github.com/nsvirk/moneybotstds/internal/models"
 	"gorm.io/gorm"
 )
 
 // AppLogger is the main struct for the logger
 type AppLogger struct {
-	db *gorm.DB
+	logger *slog.Logger
 }
 
 // NewLogger creates a new logger
 func NewAppLogger(db *gorm.DB) *AppLogger {
-	return &AppLogger{db: db}
+	return &AppLogger{logger: New(db)}
 }
 
-// Log logs a message
-func (l *AppLogger) Log(level, message string) error {
-	now := time.Now()
-	log := models.Log{
-		Timestamp: now,
-		Level:     level,
-		Message:   message,
-	}
-	return l.db.Table(models.LogsTable).Create(&log).Error
+// Logger returns the structured logger, to log with attributes
+func (l *AppLogger) Logger() *slog.Logger {
+	return l.logger
 }
 
-// Log a INFO message
-func (l *AppLogger) Info(message string) {
-	err := l.Log("INFO", message)
+// Log logs a message at a level named as in the logs table. Rows are written
+// to the table in the background, so only an unknown level is returned
+func (l *AppLogger) Log(level, message string) error {
+	lvl, err := ParseLevel(level)
 	if err != nil {
-		log.Println("Error logging INFO message:", err)
+		return err
 	}
+	l.logger.Log(context.Background(), lvl, message)
+	return nil
 }
 
-// Log a WARN message
-func (l *AppLogger) Warn(message string) {
-	err := l.Log("WARN", message)
-	if err != nil {
-		log.Println("Error logging WARN message:", err)
-	}
+// Log a INFO message with attributes as key value pairs
+func (l *AppLogger) Info(message string, args ...any) {
+	l.logger.Info(message, args...)
 }
 
-// Log a ERROR message
-func (l *AppLogger) Error(message string) {
-	err := l.Log("ERROR", message)
-	if err != nil {
-		log.Println("Error logging ERROR message:", err)
-	}
+// Log a WARN message with attributes as key value pairs
+func (l *AppLogger) Warn(message string, args ...any) {
+	l.logger.Warn(message, args...)
 }
 
-// Log a FATAL message
-func (l *AppLogger) Fatal(message string) {
-	err := l.Log("FATAL", message)
-	if err != nil {
-		log.Println("Error logging FATAL message:", err)
-	}
+// Log a ERROR message with attributes as key value pairs
+func (l *AppLogger) Error(message string, args ...any) {
+	l.logger.Error(message, args...)
 }
 
-// Log a DEBUG message
-func (l *AppLogger) Debug(message string) {
-	err := l.Log("DEBUG", message)
-	if err != nil {
-		log.Println("Error logging DEBUG message:", err)
-	}
+// Log a FATAL message with attributes as key value pairs
+func (l *AppLogger) Fatal(message string, args ...any) {
+	l.logger.Log(context.Background(), LevelFatal, message, args...)
+}
+
+// Log a DEBUG message with attributes as key value pairs
+func (l *AppLogger) Debug(message string, args ...any) {
+	l.logger.Debug(message, args...)
 }
@@ -0,0 +1,172 @@
+package logger
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nsvirk/moneybotstds/internal/metrics"
+	"github.com/nsvirk/moneybotstds/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrLogDropped is returned by the database handler when a row is dropped
+// because the queue of its table is full
+var ErrLogDropped = errors.New("log queue is full, row dropped")
+
+// BatchConfig configures the buffering of log rows
+type BatchConfig struct {
+	BufferSize    int           // rows queued per table before new rows are dropped
+	BatchSize     int           // rows inserted per statement
+	FlushInterval time.Duration // longest time a row waits in the queue
+}
+
+// BatchWriter inserts rows into a table in batches from a background
+// goroutine. Writes never block, rows are dropped when the queue is full
+type BatchWriter[T any] struct {
+	db            *gorm.DB
+	table         string
+	label         string
+	batchSize     int
+	flushInterval time.Duration
+
+	mu     sync.RWMutex
+	closed bool
+	rows   chan T
+	done   chan struct{}
+}
+
+// NewBatchWriter creates a BatchWriter for a table and starts its goroutine.
+// The label names the table in the metrics
+func NewBatchWriter[T any](db *gorm.DB, table, label string, cfg BatchConfig) *BatchWriter[T] {
+	w := &BatchWriter[T]{
+		db:            db,
+		table:         table,
+		label:         label,
+		batchSize:     max(cfg.BatchSize, 1),
+		flushInterval: cfg.FlushInterval,
+		rows:          make(chan T, max(cfg.BufferSize, 1)),
+		done:          make(chan struct{}),
+	}
+	if w.flushInterval <= 0 {
+		w.flushInterval = time.Second
+	}
+	go w.run()
+	return w
+}
+
+// Write queues a row, it returns false if the row was dropped because the
+// queue is full or the writer is closed
+func (w *BatchWriter[T]) Write(row T) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		metrics.DBLogDropped.WithLabelValues(w.label).Inc()
+		return false
+	}
+
+	select {
+	case w.rows <- row:
+		metrics.DBLogQueued.WithLabelValues(w.label).Inc()
+		return true
+	default:
+		metrics.DBLogDropped.WithLabelValues(w.label).Inc()
+		return false
+	}
+}
+
+// Close stops accepting rows and waits for the queued rows to be inserted
+func (w *BatchWriter[T]) Close() {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.rows)
+	}
+	w.mu.Unlock()
+
+	<-w.done
+}
+
+func (w *BatchWriter[T]) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]T, 0, w.batchSize)
+	for {
+		select {
+		case row, ok := <-w.rows:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			metrics.DBLogQueued.WithLabelValues(w.label).Dec()
+			batch = append(batch, row)
+			if len(batch) >= w.batchSize {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			w.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush inserts a batch. Failed batches are counted and not retried, so a
+// database outage does not back up the queue
+func (w *BatchWriter[T]) flush(batch []T) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := w.db.Table(w.table).Create(&batch).Error; err != nil {
+		metrics.DBLogFailures.WithLabelValues(w.label).Add(float64(len(batch)))
+		Stdout().Error("Failed to write log rows", "table", w.label, "rows", len(batch), "error", err)
+	}
+}
+
+// The writers of the logs tables, nil until StartBatching is called. The
+// loggers insert synchronously without them, e.g. in command line tools
+var (
+	writersMu    sync.RWMutex
+	appWriter    *BatchWriter[models.Log]
+	tickerWriter *BatchWriter[models.TickerLog]
+)
+
+// StartBatching makes the AppLogger and TickerLogger queue their rows and
+// insert them in batches. Close must be called on shutdown to flush them
+func StartBatching(db *gorm.DB, cfg BatchConfig) {
+	writersMu.Lock()
+	defer writersMu.Unlock()
+
+	if appWriter == nil {
+		appWriter = NewBatchWriter[models.Log](db, models.LogsTable, "logs", cfg)
+	}
+	if tickerWriter == nil {
+		tickerWriter = NewBatchWriter[models.TickerLog](db, models.TickerLogsTable, "ticker_logs", cfg)
+	}
+}
+
+// Close flushes the queued rows and stops batching, later rows are inserted
+// synchronously
+func Close() {
+	writersMu.Lock()
+	app, ticker := appWriter, tickerWriter
+	appWriter, tickerWriter = nil, nil
+	writersMu.Unlock()
+
+	if app != nil {
+		app.Close()
+	}
+	if ticker != nil {
+		ticker.Close()
+	}
+}
+
+func batchWriters() (*BatchWriter[models.Log], *BatchWriter[models.TickerLog]) {
+	writersMu.RLock()
+	defer writersMu.RUnlock()
+	return appWriter, tickerWriter
+}
@@ -0,0 +1,226 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nsvirk/moneybotstds/internal/metrics"
+	"github.com/nsvirk/moneybotstds/internal/models"
+	"gorm.io/gorm"
+)
+
+// FanoutHandler passes records to several handlers
+type FanoutHandler struct {
+	handlers []slog.Handler
+}
+
+// NewFanoutHandler creates a FanoutHandler
+func NewFanoutHandler(handlers ...slog.Handler) *FanoutHandler {
+	return &FanoutHandler{handlers: handlers}
+}
+
+func (h *FanoutHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	for _, handler := range h.handlers {
+		if handler.Enabled(ctx, l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *FanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, handler := range h.handlers {
+		if handler.Enabled(ctx, r.Level) {
+			errs = append(errs, handler.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *FanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make([]slog.Handler, len(h.handlers))
+	for i, handler := range h.handlers {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return &FanoutHandler{handlers: handlers}
+}
+
+func (h *FanoutHandler) WithGroup(name string) slog.Handler {
+	handlers := make([]slog.Handler, len(h.handlers))
+	for i, handler := range h.handlers {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return &FanoutHandler{handlers: handlers}
+}
+
+// DBHandler writes records to the logs tables. Records with an event type
+// are ticker events and go to `ticker_logs` with their user and bot, the
+// others go to `logs`. Remaining attributes are appended to the message as
+// key=value pairs
+type DBHandler struct {
+	db     *gorm.DB
+	level  slog.Leveler
+	attrs  []slog.Attr
+	prefix string // group names joined by dots
+}
+
+// NewDBHandler creates a DBHandler for records at or above level
+func NewDBHandler(db *gorm.DB, level slog.Leveler) *DBHandler {
+	return &DBHandler{db: db, level: level}
+}
+
+func (h *DBHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *DBHandler) Handle(_ context.Context, r slog.Record) error {
+	var userID, botID, eventType string
+	var fields []string
+
+	add := func(a slog.Attr) {
+		a.Value = a.Value.Resolve()
+		if a.Equal(slog.Attr{}) {
+			return
+		}
+		if h.prefix == "" {
+			switch a.Key {
+			case KeyUserID:
+				userID = a.Value.String()
+				return
+			case KeyBotID:
+				botID = a.Value.String()
+				return
+			case KeyEventType:
+				eventType = a.Value.String()
+				return
+			}
+		}
+		fields = appendField(fields, h.prefix, a)
+	}
+	for _, a := range h.attrs {
+		add(a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		add(a)
+		return true
+	})
+
+	if eventType != "" {
+		return writeTickerLog(h.db, models.TickerLog{
+			Timestamp: r.Time,
+			UserID:    userID,
+			BotID:     botID,
+			Level:     LevelName(r.Level),
+			EventType: eventType,
+			Message:   joinMessage(r.Message, fields),
+		})
+	}
+
+	// The logs table has no user and bot columns, keep them in the message
+	var head []string
+	if userID != "" {
+		head = append(head, KeyUserID+"="+quoteValue(userID))
+	}
+	if botID != "" {
+		head = append(head, KeyBotID+"="+quoteValue(botID))
+	}
+	fields = append(head, fields...)
+	return writeLog(h.db, models.Log{
+		Timestamp: r.Time,
+		Level:     LevelName(r.Level),
+		Message:   joinMessage(r.Message, fields),
+	})
+}
+
+func (h *DBHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = slices.Clip(h.attrs)
+	for _, a := range attrs {
+		if h.prefix != "" {
+			a.Key = h.prefix + "." + a.Key
+		}
+		h2.attrs = append(h2.attrs, a)
+	}
+	return &h2
+}
+
+func (h *DBHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	if h.prefix != "" {
+		name = h.prefix + "." + name
+	}
+	h2.prefix = name
+	return &h2
+}
+
+// appendField appends an attribute as key=value, groups are flattened
+func appendField(fields []string, prefix string, a slog.Attr) []string {
+	key := a.Key
+	if prefix != "" && !strings.HasPrefix(key, prefix+".") {
+		key = prefix + "." + key
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			fields = appendField(fields, key, ga)
+		}
+		return fields
+	}
+	return append(fields, key+"="+quoteValue(a.Value.String()))
+}
+
+func quoteValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+func joinMessage(message string, fields []string) string {
+	if len(fields) == 0 {
+		return message
+	}
+	return message + " " + strings.Join(fields, " ")
+}
+
+// writeLog queues a row of the logs table, or inserts it if batching is not
+// started
+func writeLog(db *gorm.DB, row models.Log) error {
+	if writer, _ := batchWriters(); writer != nil {
+		if !writer.Write(row) {
+			return ErrLogDropped
+		}
+		return nil
+	}
+	if err := db.Table(models.LogsTable).Create(&row).Error; err != nil {
+		metrics.DBLogFailures.WithLabelValues("logs").Inc()
+		Stdout().Error("Failed to write log row", "table", "logs", "error", err)
+		return fmt.Errorf("failed to write log: %w", err)
+	}
+	return nil
+}
+
+// writeTickerLog queues a row of the ticker_logs table, or inserts it if
+// batching is not started
+func writeTickerLog(db *gorm.DB, row models.TickerLog) error {
+	if _, writer := batchWriters(); writer != nil {
+		if !writer.Write(row) {
+			return ErrLogDropped
+		}
+		return nil
+	}
+	if err := db.Table(models.TickerLogsTable).Create(&row).Error; err != nil {
+		metrics.DBLogFailures.WithLabelValues("ticker_logs").Inc()
+		Stdout().Error("Failed to write log row", "table", "ticker_logs", "error", err)
+		return fmt.Errorf("failed to write ticker log: %w", err)
+	}
+	return nil
+}
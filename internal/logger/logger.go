@@ -0,0 +1,154 @@
+// Package logger provides the structured loggers of the service. Records are
+// written as JSON or text to stdout and to the `logs` and `ticker_logs` tables
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// Standard attribute keys of log records
+const (
+	KeyUserID    = "user_id"
+	KeyBotID     = "bot_id"
+	KeyRequestID = "request_id"
+	KeyEventType = "event_type"
+	KeyTraceID   = "trace_id"
+)
+
+// LevelFatal is the level of errors the process can not continue after
+const LevelFatal = slog.Level(12)
+
+// The options of the loggers, set by Configure
+var (
+	optionsMu sync.RWMutex
+	level               = new(slog.LevelVar)
+	format              = "json"
+	output    io.Writer = os.Stdout
+)
+
+// Configure sets the level (debug, info, warn, error or fatal), the format
+// (json or text) and the output of the loggers. The level applies to loggers
+// created before as well
+func Configure(levelName, formatName string, w io.Writer) error {
+	l, err := ParseLevel(levelName)
+	if err != nil {
+		return err
+	}
+	if formatName != "json" && formatName != "text" {
+		return fmt.Errorf("invalid log format: %s, must be json or text", formatName)
+	}
+
+	optionsMu.Lock()
+	defer optionsMu.Unlock()
+
+	level.Set(l)
+	format = formatName
+	output = w
+	return nil
+}
+
+// ParseLevel parses the name of a level, as stored in the logs tables
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToUpper(name) {
+	case "DEBUG":
+		return slog.LevelDebug, nil
+	case "INFO":
+		return slog.LevelInfo, nil
+	case "WARN":
+		return slog.LevelWarn, nil
+	case "ERROR":
+		return slog.LevelError, nil
+	case "FATAL":
+		return LevelFatal, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("invalid log level: %s", name)
+}
+
+// LevelName returns the name of a level, as stored in the logs tables
+func LevelName(l slog.Level) string {
+	if l >= LevelFatal {
+		return "FATAL"
+	}
+	return l.String()
+}
+
+// New returns a logger writing to stdout and to the logs tables of db
+func New(db *gorm.DB) *slog.Logger {
+	return slog.New(&contextHandler{NewFanoutHandler(stdoutHandler(), NewDBHandler(db, level))})
+}
+
+// Stdout returns a logger writing to stdout only, for errors of the database
+// logging itself and before the database is connected
+func Stdout() *slog.Logger {
+	return slog.New(&contextHandler{stdoutHandler()})
+}
+
+// Fatal logs an error at LevelFatal, flushes the queued rows and exits
+func Fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Log(context.Background(), LevelFatal, msg, args...)
+	Close()
+	os.Exit(1)
+}
+
+func stdoutHandler() slog.Handler {
+	optionsMu.RLock()
+	defer optionsMu.RUnlock()
+
+	opts := &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey && len(groups) == 0 {
+				if l, ok := a.Value.Any().(slog.Level); ok {
+					return slog.String(slog.LevelKey, LevelName(l))
+				}
+			}
+			return a
+		},
+	}
+	if format == "text" {
+		return slog.NewTextHandler(output, opts)
+	}
+	return slog.NewJSONHandler(output, opts)
+}
+
+type contextKey struct{}
+
+// ContextWithAttrs returns a context whose attributes are added to the
+// records logged with it, e.g. the request ID of an HTTP request
+func ContextWithAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(contextKey{}).([]slog.Attr)
+	return context.WithValue(ctx, contextKey{}, append(existing[:len(existing):len(existing)], attrs...))
+}
+
+// contextHandler adds the attributes of the context to records, and the
+// trace ID if the context has a sampled span
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(contextKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsSampled() {
+		r.AddAttrs(slog.String(KeyTraceID, sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
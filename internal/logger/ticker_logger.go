@@ -1,37 +1,35 @@
 package logger
 
 import (
-	"log"
-	"time"
+	"context"
+	"log/slog"
 
-	"github.com/nsvirk/moneybotstds/internal/models"
 	"gorm.io/gorm"
 )
 
 // TickerLogger is the main struct for the ticker logger
 type TickerLogger struct {
-	db *gorm.DB
+	logger *slog.Logger
 }
 
 // NewTickerLogger creates a new ticker	logger
 func NewTickerLogger(db *gorm.DB) *TickerLogger {
 	return &TickerLogger{
-		db: db,
+		logger: New(db),
 	}
 }
 
-// Log a TICKER message
+// Log a TICKER message. The event is written to stdout and the ticker_logs
+// table, which is written in batches when batching is started so callbacks of
+// the ticker are never blocked
 func (l *TickerLogger) Log(userID, botID, level, eventType, message string) {
-	tickerLog := models.TickerLog{
-		Timestamp: time.Now(),
-		UserID:    userID,
-		BotID:     botID,
-		Level:     level,
-		EventType: eventType,
-		Message:   message,
-	}
-	err := l.db.Table(models.TickerLogsTable).Create(&tickerLog).Error
+	lvl, err := ParseLevel(level)
 	if err != nil {
-		log.Println("Error logging TICKER message:", err)
+		lvl = slog.LevelInfo
 	}
+	l.logger.Log(context.Background(), lvl, message,
+		slog.String(KeyUserID, userID),
+		slog.String(KeyBotID, botID),
+		slog.String(KeyEventType, eventType),
+	)
 }
@@ -0,0 +1,248 @@
+package market
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Holiday closes sessions of an exchange on a date, all of them if Sessions
+// is empty. On MCX a holiday of the morning session keeps the evening open
+type Holiday struct {
+	Date     time.Time
+	Exchange string
+	Sessions []string
+}
+
+// Period is a session of an exchange held on a day. PreOpen and the post-close
+// times are zero if the session has none
+type Period struct {
+	Exchange       string
+	Session        string
+	PreOpen        time.Time
+	Open           time.Time
+	Close          time.Time
+	PostCloseStart time.Time
+	PostCloseEnd   time.Time
+}
+
+// Start returns when the period starts, with its pre-open if any
+func (p Period) Start() time.Time {
+	if !p.PreOpen.IsZero() {
+		return p.PreOpen
+	}
+	return p.Open
+}
+
+// End returns when the period ends, with its post-close if any
+func (p Period) End() time.Time {
+	if !p.PostCloseEnd.IsZero() {
+		return p.PostCloseEnd
+	}
+	return p.Close
+}
+
+// Phase is a phase of the trading day of an exchange from Start to End.
+// Session is empty while the exchange is closed
+type Phase struct {
+	Name    string
+	Session string
+	Start   time.Time
+	End     time.Time
+}
+
+// Boundary kinds, in the order they happen in a session
+const (
+	BoundaryPreOpen    = "pre_open"
+	BoundaryOpen       = "open"
+	BoundaryClose      = "close"
+	BoundarySettlement = "settlement"
+)
+
+// Boundary is a change of phase of an exchange. Settlement is when the
+// trading day of the exchange ends and its closing prices are final
+type Boundary struct {
+	Exchange string
+	Session  string
+	Kind     string
+	At       time.Time
+}
+
+// Calendar is the trading sessions of the exchanges with their holidays. It
+// is safe for concurrent use
+type Calendar struct {
+	mu       sync.RWMutex
+	holidays map[string]map[string][]string // closed sessions by date and exchange
+}
+
+// NewCalendar creates a calendar without holidays
+func NewCalendar() *Calendar {
+	return &Calendar{holidays: make(map[string]map[string][]string)}
+}
+
+// SetHolidays replaces the holidays of the calendar
+func (c *Calendar) SetHolidays(holidays []Holiday) {
+	byDate := make(map[string]map[string][]string)
+	for _, holiday := range holidays {
+		date := holiday.Date.In(IST).Format(time.DateOnly)
+		if byDate[date] == nil {
+			byDate[date] = make(map[string][]string)
+		}
+		exchange := strings.ToUpper(holiday.Exchange)
+		closed, seen := byDate[date][exchange]
+		switch {
+		case seen && len(closed) == 0:
+			// Already closed all day
+		case len(holiday.Sessions) == 0:
+			byDate[date][exchange] = []string{}
+		default:
+			byDate[date][exchange] = append(closed, holiday.Sessions...)
+		}
+	}
+
+	c.mu.Lock()
+	c.holidays = byDate
+	c.mu.Unlock()
+}
+
+// Periods returns the sessions of an exchange held on the day of t in IST,
+// in order
+func (c *Calendar) Periods(exchange string, t time.Time) []Period {
+	day := t.In(IST)
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, IST)
+
+	exchange = strings.ToUpper(exchange)
+	closed, holiday := c.closedSessions(exchange, midnight)
+
+	var periods []Period
+	for _, session := range regularSessions(exchange, midnight) {
+		if holiday && (len(closed) == 0 || slices.Contains(closed, session.Name)) {
+			continue
+		}
+		period := Period{
+			Exchange: exchange,
+			Session:  session.Name,
+			Open:     midnight.Add(session.Open),
+			Close:    midnight.Add(session.Close),
+		}
+		if session.PreOpen > 0 {
+			period.PreOpen = midnight.Add(session.PreOpen)
+		}
+		if session.PostCloseEnd > 0 {
+			period.PostCloseStart = midnight.Add(session.PostCloseStart)
+			period.PostCloseEnd = midnight.Add(session.PostCloseEnd)
+		}
+		periods = append(periods, period)
+	}
+	return periods
+}
+
+// phases returns the phases of an exchange on the day of t in IST, without
+// the closed ones
+func (c *Calendar) phases(exchange string, t time.Time) []Phase {
+	var phases []Phase
+	for _, period := range c.Periods(exchange, t) {
+		if !period.PreOpen.IsZero() {
+			phases = append(phases, Phase{Name: PhasePreOpen, Session: period.Session, Start: period.PreOpen, End: period.Open})
+		}
+		phases = append(phases, Phase{Name: PhaseOpen, Session: period.Session, Start: period.Open, End: period.Close})
+		if !period.PostCloseEnd.IsZero() {
+			phases = append(phases, Phase{Name: PhasePostClose, Session: period.Session, Start: period.PostCloseStart, End: period.PostCloseEnd})
+		}
+	}
+	return phases
+}
+
+// PhaseAt returns the phase of an exchange at t. A closed phase starts at the
+// end of the previous phase of the day, or at midnight IST, and ends at the
+// start of the next one, or at the next midnight
+func (c *Calendar) PhaseAt(exchange string, t time.Time) Phase {
+	day := t.In(IST)
+	closed := Phase{
+		Name:  PhaseClosed,
+		Start: time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, IST),
+	}
+	closed.End = closed.Start.AddDate(0, 0, 1)
+
+	for _, phase := range c.phases(exchange, t) {
+		if t.Before(phase.Start) {
+			closed.End = phase.Start
+			break
+		}
+		if t.Before(phase.End) {
+			return phase
+		}
+		closed.Start = phase.End
+	}
+	return closed
+}
+
+// Boundaries returns the boundaries of the sessions of an exchange after from
+// up to and including to, in order
+func (c *Calendar) Boundaries(exchange string, from, to time.Time) []Boundary {
+	var boundaries []Boundary
+	add := func(period Period, kind string, at time.Time) {
+		if at.After(from) && !at.After(to) {
+			boundaries = append(boundaries, Boundary{Exchange: period.Exchange, Session: period.Session, Kind: kind, At: at})
+		}
+	}
+
+	// Sessions of the day before may end after midnight
+	for day := from.In(IST).AddDate(0, 0, -1); !day.After(to.AddDate(0, 0, 1)); day = day.AddDate(0, 0, 1) {
+		periods := c.Periods(exchange, day)
+		for i, period := range periods {
+			if !period.PreOpen.IsZero() {
+				add(period, BoundaryPreOpen, period.PreOpen)
+			}
+			add(period, BoundaryOpen, period.Open)
+			add(period, BoundaryClose, period.Close)
+			if i == len(periods)-1 {
+				add(period, BoundarySettlement, period.End())
+			}
+		}
+	}
+	return boundaries
+}
+
+func (c *Calendar) closedSessions(exchange string, midnight time.Time) ([]string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	closed, ok := c.holidays[midnight.Format(time.DateOnly)][exchange]
+	return closed, ok
+}
+
+// OpenSince returns when an exchange opened if it is open at t, sessions
+// following each other counting as one. ok is false if the exchange is closed
+// at t or its sessions are not known
+func (c *Calendar) OpenSince(exchange string, t time.Time) (opened time.Time, ok bool) {
+	var closed time.Time
+	for _, period := range c.Periods(exchange, t) {
+		if !period.Open.Equal(closed) {
+			opened = period.Open
+		}
+		closed = period.Close
+		if !t.Before(period.Open) && t.Before(period.Close) {
+			return opened, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// TradingHours returns the first start and the last end of the sessions of
+// exchanges held on the day of t in IST, pre-open and post-close included. ok
+// is false if none is held
+func (c *Calendar) TradingHours(exchanges []string, t time.Time) (open, close time.Time, ok bool) {
+	for _, exchange := range exchanges {
+		for _, period := range c.Periods(exchange, t) {
+			if !ok || period.Start().Before(open) {
+				open = period.Start()
+			}
+			if !ok || period.End().After(close) {
+				close = period.End()
+			}
+			ok = true
+		}
+	}
+	return open, close, ok
+}
@@ -0,0 +1,332 @@
+package market
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// at returns the time of a clock on a date in IST
+func at(date, clock string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", date+" "+clock, IST)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func date(value string) time.Time {
+	return at(value, "00:00")
+}
+
+// testCalendar has an NSE holiday on 2025-01-07 and an MCX morning holiday on
+// 2025-01-08
+func testCalendar() *Calendar {
+	c := NewCalendar()
+	c.SetHolidays([]Holiday{
+		{Date: date("2025-01-07"), Exchange: "NSE"},
+		{Date: date("2025-01-08"), Exchange: "mcx", Sessions: []string{SessionMorning}},
+	})
+	return c
+}
+
+func TestPeriods(t *testing.T) {
+	tests := []struct {
+		name     string
+		exchange string
+		day      string
+		want     []Period
+	}{
+		{
+			name:     "equity session",
+			exchange: "NSE",
+			day:      "2025-01-06",
+			want: []Period{{
+				Exchange:       "NSE",
+				Session:        SessionNormal,
+				PreOpen:        at("2025-01-06", "09:00"),
+				Open:           at("2025-01-06", "09:15"),
+				Close:          at("2025-01-06", "15:30"),
+				PostCloseStart: at("2025-01-06", "15:40"),
+				PostCloseEnd:   at("2025-01-06", "16:00"),
+			}},
+		},
+		{
+			name:     "lower case exchange",
+			exchange: "nfo",
+			day:      "2025-01-06",
+			want: []Period{{
+				Exchange: "NFO",
+				Session:  SessionNormal,
+				Open:     at("2025-01-06", "09:15"),
+				Close:    at("2025-01-06", "15:30"),
+			}},
+		},
+		{
+			name:     "mcx sessions",
+			exchange: "MCX",
+			day:      "2025-01-06",
+			want: []Period{
+				{Exchange: "MCX", Session: SessionMorning, Open: at("2025-01-06", "09:00"), Close: at("2025-01-06", "17:00")},
+				{Exchange: "MCX", Session: SessionEvening, Open: at("2025-01-06", "17:00"), Close: at("2025-01-06", "23:55")},
+			},
+		},
+		{
+			name:     "mcx morning holiday",
+			exchange: "MCX",
+			day:      "2025-01-08",
+			want: []Period{
+				{Exchange: "MCX", Session: SessionEvening, Open: at("2025-01-08", "17:00"), Close: at("2025-01-08", "23:55")},
+			},
+		},
+		{
+			name:     "holiday",
+			exchange: "NSE",
+			day:      "2025-01-07",
+		},
+		{
+			name:     "holiday of another exchange",
+			exchange: "BSE",
+			day:      "2025-01-07",
+			want: []Period{{
+				Exchange:       "BSE",
+				Session:        SessionNormal,
+				PreOpen:        at("2025-01-07", "09:00"),
+				Open:           at("2025-01-07", "09:15"),
+				Close:          at("2025-01-07", "15:30"),
+				PostCloseStart: at("2025-01-07", "15:40"),
+				PostCloseEnd:   at("2025-01-07", "16:00"),
+			}},
+		},
+		{
+			name:     "weekend",
+			exchange: "NSE",
+			day:      "2025-01-04",
+		},
+		{
+			name:     "unknown exchange",
+			exchange: "NYSE",
+			day:      "2025-01-06",
+		},
+	}
+
+	c := testCalendar()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Any time of the day in IST selects it
+			got := c.Periods(tt.exchange, at(tt.day, "12:00").UTC())
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Periods() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMCXEveningCloseDST(t *testing.T) {
+	tests := []struct {
+		day  string
+		want string
+	}{
+		{"2025-03-07", "23:55"}, // before the second Sunday of March
+		{"2025-03-10", "23:30"},
+		{"2025-07-07", "23:30"},
+		{"2025-10-31", "23:30"},
+		{"2025-11-03", "23:55"}, // after the first Sunday of November
+		{"2025-12-01", "23:55"},
+	}
+
+	c := NewCalendar()
+	for _, tt := range tests {
+		t.Run(tt.day, func(t *testing.T) {
+			periods := c.Periods("MCX", date(tt.day))
+			if len(periods) != 2 {
+				t.Fatalf("Periods() returned %d periods, want 2", len(periods))
+			}
+			if got := periods[1].Close; !got.Equal(at(tt.day, tt.want)) {
+				t.Errorf("evening close = %s, want %s", got.Format("15:04"), tt.want)
+			}
+		})
+	}
+}
+
+func TestPhaseAt(t *testing.T) {
+	tests := []struct {
+		name     string
+		exchange string
+		t        time.Time
+		want     Phase
+	}{
+		{
+			name:     "before pre-open",
+			exchange: "NSE",
+			t:        at("2025-01-06", "08:00"),
+			want:     Phase{Name: PhaseClosed, Start: date("2025-01-06"), End: at("2025-01-06", "09:00")},
+		},
+		{
+			name:     "pre-open",
+			exchange: "NSE",
+			t:        at("2025-01-06", "09:05"),
+			want:     Phase{Name: PhasePreOpen, Session: SessionNormal, Start: at("2025-01-06", "09:00"), End: at("2025-01-06", "09:15")},
+		},
+		{
+			name:     "open at the open",
+			exchange: "NSE",
+			t:        at("2025-01-06", "09:15"),
+			want:     Phase{Name: PhaseOpen, Session: SessionNormal, Start: at("2025-01-06", "09:15"), End: at("2025-01-06", "15:30")},
+		},
+		{
+			name:     "between close and post-close",
+			exchange: "NSE",
+			t:        at("2025-01-06", "15:35"),
+			want:     Phase{Name: PhaseClosed, Start: at("2025-01-06", "15:30"), End: at("2025-01-06", "15:40")},
+		},
+		{
+			name:     "post-close",
+			exchange: "NSE",
+			t:        at("2025-01-06", "15:45"),
+			want:     Phase{Name: PhasePostClose, Session: SessionNormal, Start: at("2025-01-06", "15:40"), End: at("2025-01-06", "16:00")},
+		},
+		{
+			name:     "after post-close",
+			exchange: "NSE",
+			t:        at("2025-01-06", "17:00"),
+			want:     Phase{Name: PhaseClosed, Start: at("2025-01-06", "16:00"), End: date("2025-01-07")},
+		},
+		{
+			name:     "holiday",
+			exchange: "NSE",
+			t:        at("2025-01-07", "10:00"),
+			want:     Phase{Name: PhaseClosed, Start: date("2025-01-07"), End: date("2025-01-08")},
+		},
+		{
+			name:     "mcx evening at its open",
+			exchange: "MCX",
+			t:        at("2025-01-06", "17:00"),
+			want:     Phase{Name: PhaseOpen, Session: SessionEvening, Start: at("2025-01-06", "17:00"), End: at("2025-01-06", "23:55")},
+		},
+		{
+			name:     "mcx morning holiday",
+			exchange: "MCX",
+			t:        at("2025-01-08", "10:00"),
+			want:     Phase{Name: PhaseClosed, Start: date("2025-01-08"), End: at("2025-01-08", "17:00")},
+		},
+	}
+
+	c := testCalendar()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := c.PhaseAt(tt.exchange, tt.t)
+			if got.Name != tt.want.Name || got.Session != tt.want.Session || !got.Start.Equal(tt.want.Start) || !got.End.Equal(tt.want.End) {
+				t.Errorf("PhaseAt() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBoundaries(t *testing.T) {
+	type boundary struct {
+		session string
+		kind    string
+		at      time.Time
+	}
+
+	tests := []struct {
+		name     string
+		exchange string
+		from, to time.Time
+		want     []boundary
+	}{
+		{
+			name:     "equity day",
+			exchange: "NSE",
+			from:     date("2025-01-06"),
+			to:       date("2025-01-07"),
+			want: []boundary{
+				{SessionNormal, BoundaryPreOpen, at("2025-01-06", "09:00")},
+				{SessionNormal, BoundaryOpen, at("2025-01-06", "09:15")},
+				{SessionNormal, BoundaryClose, at("2025-01-06", "15:30")},
+				{SessionNormal, BoundarySettlement, at("2025-01-06", "16:00")},
+			},
+		},
+		{
+			name:     "after from up to and including to",
+			exchange: "NSE",
+			from:     at("2025-01-06", "09:15"),
+			to:       at("2025-01-06", "15:30"),
+			want: []boundary{
+				{SessionNormal, BoundaryClose, at("2025-01-06", "15:30")},
+			},
+		},
+		{
+			name:     "mcx day",
+			exchange: "MCX",
+			from:     date("2025-01-06"),
+			to:       date("2025-01-07"),
+			want: []boundary{
+				{SessionMorning, BoundaryOpen, at("2025-01-06", "09:00")},
+				{SessionMorning, BoundaryClose, at("2025-01-06", "17:00")},
+				{SessionEvening, BoundaryOpen, at("2025-01-06", "17:00")},
+				{SessionEvening, BoundaryClose, at("2025-01-06", "23:55")},
+				{SessionEvening, BoundarySettlement, at("2025-01-06", "23:55")},
+			},
+		},
+		{
+			name:     "holiday",
+			exchange: "NSE",
+			from:     date("2025-01-07"),
+			to:       date("2025-01-08"),
+		},
+		{
+			name:     "weekend",
+			exchange: "NSE",
+			from:     date("2025-01-04"),
+			to:       date("2025-01-06"),
+		},
+	}
+
+	c := testCalendar()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []boundary
+			for _, b := range c.Boundaries(tt.exchange, tt.from, tt.to) {
+				got = append(got, boundary{b.Session, b.Kind, b.At})
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Boundaries() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].session != tt.want[i].session || got[i].kind != tt.want[i].kind || !got[i].at.Equal(tt.want[i].at) {
+					t.Errorf("Boundaries()[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestOpenSince(t *testing.T) {
+	tests := []struct {
+		name     string
+		exchange string
+		t        time.Time
+		want     time.Time
+		wantOK   bool
+	}{
+		{"open", "NSE", at("2025-01-06", "10:00"), at("2025-01-06", "09:15"), true},
+		{"pre-open is not open", "NSE", at("2025-01-06", "09:05"), time.Time{}, false},
+		{"after close", "NSE", at("2025-01-06", "15:45"), time.Time{}, false},
+		{"mcx sessions count as one", "MCX", at("2025-01-06", "20:00"), at("2025-01-06", "09:00"), true},
+		{"mcx morning holiday", "MCX", at("2025-01-08", "20:00"), at("2025-01-08", "17:00"), true},
+		{"holiday", "NSE", at("2025-01-07", "10:00"), time.Time{}, false},
+		{"unknown exchange", "NYSE", at("2025-01-06", "10:00"), time.Time{}, false},
+	}
+
+	c := testCalendar()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := c.OpenSince(tt.exchange, tt.t)
+			if ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Errorf("OpenSince() = %s, %v, want %s, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
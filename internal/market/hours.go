@@ -0,0 +1,125 @@
+// Package market knows when the exchanges whose instruments are published
+// are open for trading
+package market
+
+import (
+	"strings"
+	"time"
+)
+
+// IST is the time zone trading hours are in
+var IST = time.FixedZone("IST", 5*60*60+30*60)
+
+// Session names
+const (
+	SessionNormal  = "normal"
+	SessionMorning = "morning"
+	SessionEvening = "evening"
+)
+
+// Phases of the trading day of an exchange
+const (
+	PhasePreOpen   = "pre_open"
+	PhaseOpen      = "open"
+	PhasePostClose = "post_close"
+	PhaseClosed    = "closed"
+)
+
+// Session is a trading session of an exchange, as the time since midnight IST.
+// PreOpen is the start of the pre-open call auction before Open and
+// PostCloseStart to PostCloseEnd the closing price session after Close, 0 if
+// the session has none
+type Session struct {
+	Name           string
+	PreOpen        time.Duration
+	Open           time.Duration
+	Close          time.Duration
+	PostCloseStart time.Duration
+	PostCloseEnd   time.Duration
+}
+
+// equitySession is the session of the NSE and BSE cash markets
+var equitySession = Session{
+	Name:           SessionNormal,
+	PreOpen:        9 * time.Hour,
+	Open:           9*time.Hour + 15*time.Minute,
+	Close:          15*time.Hour + 30*time.Minute,
+	PostCloseStart: 15*time.Hour + 40*time.Minute,
+	PostCloseEnd:   16 * time.Hour,
+}
+
+// sessions are the regular trading sessions of the exchanges on weekdays, in
+// order. The MCX evening session closes earlier, at mcxEveningCloseDST, while
+// the US is on daylight saving time
+var sessions = map[string][]Session{
+	"NSE": {equitySession},
+	"BSE": {equitySession},
+	"NFO": {{Name: SessionNormal, Open: 9*time.Hour + 15*time.Minute, Close: 15*time.Hour + 30*time.Minute}},
+	"BFO": {{Name: SessionNormal, Open: 9*time.Hour + 15*time.Minute, Close: 15*time.Hour + 30*time.Minute}},
+	"CDS": {{Name: SessionNormal, Open: 9 * time.Hour, Close: 17 * time.Hour}},
+	"BCD": {{Name: SessionNormal, Open: 9 * time.Hour, Close: 17 * time.Hour}},
+	"MCX": {
+		{Name: SessionMorning, Open: 9 * time.Hour, Close: 17 * time.Hour},
+		{Name: SessionEvening, Open: 17 * time.Hour, Close: 23*time.Hour + 55*time.Minute},
+	},
+}
+
+const mcxEveningCloseDST = 23*time.Hour + 30*time.Minute
+
+// Exchanges returns the exchanges whose sessions are known
+func Exchanges() []string {
+	return []string{"NSE", "BSE", "NFO", "BFO", "CDS", "BCD", "MCX"}
+}
+
+// Known reports whether the sessions of an exchange are known
+func Known(exchange string) bool {
+	_, ok := sessions[strings.ToUpper(exchange)]
+	return ok
+}
+
+// SessionNames returns the names of the sessions of an exchange, in order
+func SessionNames(exchange string) []string {
+	var names []string
+	for _, session := range sessions[strings.ToUpper(exchange)] {
+		names = append(names, session.Name)
+	}
+	return names
+}
+
+// regularSessions returns the sessions of an exchange on a day before
+// holidays, none on weekends
+func regularSessions(exchange string, day time.Time) []Session {
+	if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+		return nil
+	}
+
+	exchange = strings.ToUpper(exchange)
+	regular := sessions[exchange]
+	if exchange != "MCX" || !usDST(day) {
+		return regular
+	}
+
+	dst := make([]Session, len(regular))
+	copy(dst, regular)
+	for i := range dst {
+		if dst[i].Name == SessionEvening {
+			dst[i].Close = mcxEveningCloseDST
+		}
+	}
+	return dst
+}
+
+// usDST reports whether the US is on daylight saving time on a day, from the
+// second Sunday of March to the first Sunday of November
+func usDST(day time.Time) bool {
+	start := nthSunday(day.Year(), time.March, 2)
+	end := nthSunday(day.Year(), time.November, 1)
+	date := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, IST)
+	return !date.Before(start) && date.Before(end)
+}
+
+func nthSunday(year int, month time.Month, n int) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, IST)
+	offset := (7 - int(first.Weekday())) % 7
+	return first.AddDate(0, 0, offset+7*(n-1))
+}
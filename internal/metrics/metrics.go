@@ -0,0 +1,193 @@
+// Package metrics defines the Prometheus metrics of the service, registered
+// with the default registry and served on /metrics
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "mbtds"
+
+var (
+	// TicksReceived counts the ticks received from Kite, including the
+	// underlying futures subscribed for greeks
+	TicksReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ticks_received_total",
+		Help:      "Ticks received from Kite.",
+	}, []string{"user_id", "bot_id"})
+
+	// TicksPublished counts the ticks published to Redis
+	TicksPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ticks_published_total",
+		Help:      "Ticks published to Redis.",
+	}, []string{"user_id", "bot_id"})
+
+	// PublishErrors counts the ticks that failed to be published
+	PublishErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "publish_errors_total",
+		Help:      "Ticks that failed to be marshalled or published.",
+	}, []string{"user_id", "bot_id"})
+
+	// RedisPublishSeconds is the latency of Redis publishes of ticks
+	RedisPublishSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "redis_publish_seconds",
+		Help:      "Latency of Redis publishes of ticks.",
+		Buckets:   []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25},
+	})
+
+	// TickAgeSeconds is the publish time minus the exchange timestamp of ticks
+	TickAgeSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tick_age_seconds",
+		Help:      "Publish time minus exchange timestamp of ticks.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2, 5, 10, 30, 60},
+	}, []string{"exchange"})
+
+	// TickLatencySeconds is the latency of ticks by bot and stage: feed is from
+	// the exchange timestamp to the receive from Kite, publish from the receive
+	// to the Redis publish and total from the exchange timestamp to the publish
+	TickLatencySeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tick_latency_seconds",
+		Help:      "Latency of ticks by stage.",
+		Buckets:   []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2, 5, 10, 30},
+	}, []string{"user_id", "bot_id", "stage"})
+
+	// SlowInstruments is the number of instruments of each bot whose tick
+	// latency is above the threshold
+	SlowInstruments = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "slow_instruments",
+		Help:      "Instruments whose tick latency is above the threshold.",
+	}, []string{"user_id", "bot_id"})
+
+	// StaleInstruments is the number of instruments of each bot that stopped
+	// ticking while their exchange is open
+	StaleInstruments = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stale_instruments",
+		Help:      "Instruments that stopped ticking while their exchange is open.",
+	}, []string{"user_id", "bot_id"})
+
+	// FeedRecoveries counts the resubscribes and reconnects of stale feeds
+	FeedRecoveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "feed_recoveries_total",
+		Help:      "Resubscribes and reconnects of stale feeds.",
+	}, []string{"user_id", "bot_id", "action"})
+
+	// ActiveTickers is the number of running tickers
+	ActiveTickers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_tickers",
+		Help:      "Running tickers.",
+	})
+
+	// SubscribedInstruments is the number of instruments subscribed by each bot
+	SubscribedInstruments = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "subscribed_instruments",
+		Help:      "Instruments subscribed by running tickers.",
+	}, []string{"user_id", "bot_id"})
+
+	// Reconnects counts the reconnect attempts of tickers
+	Reconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconnects_total",
+		Help:      "Ticker reconnect attempts.",
+	}, []string{"user_id", "bot_id"})
+
+	// HTTPRequests counts the HTTP requests by route and status
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestSeconds is the latency of HTTP requests by route
+	HTTPRequestSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_seconds",
+		Help:      "Latency of HTTP requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// DBLogFailures counts the log rows that failed to be written, by table
+	DBLogFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_log_failures_total",
+		Help:      "Log rows that failed to be written to the database.",
+	}, []string{"table"})
+
+	// DBLogDropped counts the log rows dropped because the queue was full
+	DBLogDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_log_dropped_total",
+		Help:      "Log rows dropped because the queue was full.",
+	}, []string{"table"})
+
+	// LogRowsPruned counts the rows deleted from the logs tables by retention
+	LogRowsPruned = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "log_rows_pruned_total",
+		Help:      "Rows deleted from the logs tables by retention.",
+	}, []string{"table"})
+
+	// DBLogQueued is the number of log rows waiting to be written, by table
+	DBLogQueued = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "db_log_queued",
+		Help:      "Log rows waiting to be written to the database.",
+	}, []string{"table"})
+)
+
+// TickerMetrics are the metrics of one ticker, resolved once so ticks do not
+// look up their labels
+type TickerMetrics struct {
+	TicksReceived  prometheus.Counter
+	TicksPublished prometheus.Counter
+	PublishErrors  prometheus.Counter
+
+	FeedLatency     prometheus.Observer
+	PublishLatency  prometheus.Observer
+	TotalLatency    prometheus.Observer
+	SlowInstruments prometheus.Gauge
+
+	StaleInstruments prometheus.Gauge
+}
+
+// NewTickerMetrics returns the metrics of the ticker of a bot
+func NewTickerMetrics(userID, botID string) *TickerMetrics {
+	return &TickerMetrics{
+		TicksReceived:  TicksReceived.WithLabelValues(userID, botID),
+		TicksPublished: TicksPublished.WithLabelValues(userID, botID),
+		PublishErrors:  PublishErrors.WithLabelValues(userID, botID),
+
+		FeedLatency:     TickLatencySeconds.WithLabelValues(userID, botID, "feed"),
+		PublishLatency:  TickLatencySeconds.WithLabelValues(userID, botID, "publish"),
+		TotalLatency:    TickLatencySeconds.WithLabelValues(userID, botID, "total"),
+		SlowInstruments: SlowInstruments.WithLabelValues(userID, botID),
+
+		StaleInstruments: StaleInstruments.WithLabelValues(userID, botID),
+	}
+}
+
+// DeleteTickerMetrics deletes the series of the ticker of a bot once it
+// stopped, so the series of stopped bots do not pile up
+func DeleteTickerMetrics(userID, botID string) {
+	labels := prometheus.Labels{"user_id": userID, "bot_id": botID}
+	TicksReceived.Delete(labels)
+	TicksPublished.Delete(labels)
+	PublishErrors.Delete(labels)
+	TickLatencySeconds.DeletePartialMatch(labels)
+	SlowInstruments.Delete(labels)
+	StaleInstruments.Delete(labels)
+	FeedRecoveries.DeletePartialMatch(labels)
+	SubscribedInstruments.Delete(labels)
+	Reconnects.Delete(labels)
+}
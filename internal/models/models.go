@@ -1,10 +1,8 @@
 package models
 
 import (
-	"log"
+	"os"
 	"time"
-
-	"github.com/nsvirk/moneybotstds/internal/config"
 )
 
 var (
@@ -13,16 +11,24 @@ var (
 	TickerInstrumentsTable = SchemaName + "." + "ticker_instruments"
 	LogsTable              = SchemaName + "." + "logs"
 	TickerLogsTable        = SchemaName + "." + "ticker_logs"
-	InstrumentsTable       = "api.instruments"
+	InstrumentsTable       = SchemaName + "." + "instruments"
+	InstrumentLoadsTable   = SchemaName + "." + "instrument_loads"
+	APIKeysTable           = SchemaName + "." + "api_keys"
+	CredentialsTable       = SchemaName + "." + "credentials"
+	TickersTable           = SchemaName + "." + "tickers"
+	WebhooksTable          = SchemaName + "." + "webhooks"
+	WebhookDeliveriesTable = SchemaName + "." + "webhook_deliveries"
+	QuotasTable            = SchemaName + "." + "quotas"
+	AuditLogsTable         = SchemaName + "." + "audit_logs"
+	MarketHolidaysTable    = SchemaName + "." + "market_holidays"
 )
 
+// getSchemaName returns the configured schema. It is read from the
+// environment rather than with config.Load, so packages using the models can
+// be tested without a full configuration, the commands check it with
+// config.Load before connecting
 func getSchemaName() string {
-	// Load configuration
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
-	}
-	return cfg.PostgresSchema
+	return os.Getenv("MB_TDS_PG_SCHEMA")
 }
 
 // User represents the tickserver.users table
@@ -53,10 +59,93 @@ func (TickerInstrument) TableName() string {
 	return TickerInstrumentsTable
 }
 
+// Instrument represents the instruments table, loaded from the Kite instruments dump
+type Instrument struct {
+	InstrumentToken uint32 `gorm:"primaryKey;autoIncrement:false"`
+	ExchangeToken   uint32
+	Tradingsymbol   string `gorm:"index:idx_exchange_tradingsymbol,priority:2"`
+	Name            string `gorm:"index"`
+	LastPrice       float64
+	Expiry          *time.Time `gorm:"type:date;index"`
+	Strike          float64
+	TickSize        float64
+	LotSize         int
+	InstrumentType  string
+	Segment         string
+	Exchange        string    `gorm:"index:idx_exchange_tradingsymbol,priority:1"`
+	UpdatedAt       time.Time `gorm:"autoUpdateTime"`
+}
+
+func (Instrument) TableName() string {
+	return InstrumentsTable
+}
+
+// InstrumentLoad represents the instrument loads table, one row per refresh
+type InstrumentLoad struct {
+	ID            uint32 `gorm:"primaryKey"`
+	Source        string
+	InstrumentsCt int
+	PrunedCt      int
+	LoadedAt      time.Time `gorm:"index"`
+}
+
+func (InstrumentLoad) TableName() string {
+	return InstrumentLoadsTable
+}
+
+// APIKey represents the api keys table, service-issued keys used by bots
+// instead of enctokens. Only the SHA-256 hash of the secret is stored
+type APIKey struct {
+	ID         uint32 `gorm:"primaryKey"`
+	UserID     string `gorm:"index"`
+	APIKey     string `gorm:"uniqueIndex"`
+	SecretHash string
+	Name       string
+	Scopes     string // comma separated
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+func (APIKey) TableName() string {
+	return APIKeysTable
+}
+
+// Credential represents the credentials table, the enctoken of each user
+// encrypted with the key KeyID
+type Credential struct {
+	ID         uint32 `gorm:"primaryKey"`
+	UserID     string `gorm:"uniqueIndex"`
+	KeyID      string
+	Ciphertext string
+	UpdatedAt  time.Time `gorm:"autoUpdateTime"`
+}
+
+func (Credential) TableName() string {
+	return CredentialsTable
+}
+
+// Ticker represents the tickers table, the state of each bot's ticker so it
+// can be resumed after a restart
+type Ticker struct {
+	ID        uint32 `gorm:"primaryKey"`
+	UserID    string `gorm:"uniqueIndex:idx_tickers_user_bot,priority:1"`
+	BotID     string `gorm:"uniqueIndex:idx_tickers_user_bot,priority:2"`
+	Status    string `gorm:"index"`
+	Options   string // JSON encoded ticker options
+	StartedAt time.Time
+	StoppedAt *time.Time
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+func (Ticker) TableName() string {
+	return TickersTable
+}
+
 // Log represents the logs table
 type Log struct {
-	ID        uint32 `gorm:"primaryKey"`
-	Timestamp time.Time
+	ID        uint32    `gorm:"primaryKey"`
+	Timestamp time.Time `gorm:"index"`
 	Level     string
 	Message   string
 }
@@ -67,10 +156,10 @@ func (Log) TableName() string {
 
 // TickerLog represents the ticker logs table
 type TickerLog struct {
-	ID        uint32 `gorm:"primaryKey"`
-	Timestamp time.Time
-	UserID    string
-	BotID     string
+	ID        uint32    `gorm:"primaryKey"`
+	Timestamp time.Time `gorm:"index"`
+	UserID    string    `gorm:"index:idx_ticker_logs_user_bot,priority:1"`
+	BotID     string    `gorm:"index:idx_ticker_logs_user_bot,priority:2"`
 	Level     string
 	EventType string
 	Message   string
@@ -79,3 +168,95 @@ type TickerLog struct {
 func (TickerLog) TableName() string {
 	return TickerLogsTable
 }
+
+// Webhook represents the webhooks table, a URL notified of the lifecycle
+// events of the tickers of a user, or of one bot if BotID is set. The secret
+// signs the payloads, so it is stored as is
+type Webhook struct {
+	ID        uint32 `gorm:"primaryKey"`
+	UserID    string `gorm:"index"`
+	BotID     string // empty for all bots of the user
+	URL       string
+	Secret    string
+	Events    string // comma separated
+	CreatedAt time.Time
+}
+
+func (Webhook) TableName() string {
+	return WebhooksTable
+}
+
+// WebhookDelivery represents the webhook deliveries table, one row per
+// delivery attempt
+type WebhookDelivery struct {
+	ID          uint32 `gorm:"primaryKey"`
+	WebhookID   uint32 `gorm:"index"`
+	DeliveryID  string `gorm:"index"` // shared by the attempts of a delivery
+	BotID       string
+	Event       string
+	Payload     string
+	Attempt     int
+	StatusCode  int
+	Error       string
+	Success     bool
+	DurationMs  int64
+	AttemptedAt time.Time
+}
+
+func (WebhookDelivery) TableName() string {
+	return WebhookDeliveriesTable
+}
+
+// Quota represents the quotas table, the limits of a user overriding the
+// configured defaults. A nil limit uses the default, 0 is unlimited
+type Quota struct {
+	ID                   uint32 `gorm:"primaryKey"`
+	UserID               string `gorm:"uniqueIndex"`
+	MaxBots              *int
+	MaxInstrumentsPerBot *int
+	MaxInstruments       *int
+	MaxCallsPerMinute    *int
+	UpdatedAt            time.Time `gorm:"autoUpdateTime"`
+}
+
+func (Quota) TableName() string {
+	return QuotasTable
+}
+
+// AuditLog represents the audit logs table, an append-only record of the API
+// actions of users and operators
+type AuditLog struct {
+	ID         uint32    `gorm:"primaryKey"`
+	Timestamp  time.Time `gorm:"index"`
+	Actor      string    // "user" or "admin"
+	AuthScheme string
+	UserID     string `gorm:"index"`
+	BotID      string `gorm:"index"`
+	Action     string
+	Method     string
+	Path       string
+	Summary    string // request body with secrets redacted and long lists counted
+	RemoteIP   string
+	Status     int
+	Outcome    string // "success" or "failure"
+	Error      string
+	LatencyMs  int64
+}
+
+func (AuditLog) TableName() string {
+	return AuditLogsTable
+}
+
+// MarketHoliday represents the market holidays table, the sessions of an
+// exchange closed on a date
+type MarketHoliday struct {
+	ID          uint32    `gorm:"primaryKey"`
+	Date        time.Time `gorm:"type:date;uniqueIndex:idx_market_holidays_date_exchange,priority:1"`
+	Exchange    string    `gorm:"uniqueIndex:idx_market_holidays_date_exchange,priority:2"`
+	Sessions    string    // comma separated closed sessions, empty for all
+	Description string
+}
+
+func (MarketHoliday) TableName() string {
+	return MarketHolidaysTable
+}
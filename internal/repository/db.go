@@ -5,6 +5,7 @@ import (
 
 	"github.com/nsvirk/moneybotstds/internal/config"
 	"github.com/nsvirk/moneybotstds/internal/models"
+	"github.com/nsvirk/moneybotstds/internal/tracing"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -34,6 +35,11 @@ func InitDB(cfg *config.Config) (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	// Trace the queries of traced requests
+	if err := db.Use(tracing.NewGormPlugin()); err != nil {
+		return nil, fmt.Errorf("failed to register tracing: %w", err)
+	}
+
 	// Create schema
 	sql := fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", cfg.PostgresSchema)
 	tx := db.Exec(sql)
@@ -42,11 +48,16 @@ func InitDB(cfg *config.Config) (*gorm.DB, error) {
 	}
 
 	// Auto migrate the schema
-	err = db.AutoMigrate(&models.User{}, &models.TickerInstrument{}, &models.Log{}, &models.TickerLog{})
+	err = db.AutoMigrate(&models.User{}, &models.TickerInstrument{}, &models.Log{}, &models.TickerLog{}, &models.Instrument{}, &models.InstrumentLoad{}, &models.APIKey{}, &models.Credential{}, &models.Ticker{}, &models.Webhook{}, &models.WebhookDelivery{}, &models.Quota{}, &models.AuditLog{}, &models.MarketHoliday{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	// Reject updates and deletes of audit logs
+	if err := makeAppendOnly(db, models.AuditLogsTable); err != nil {
+		return nil, fmt.Errorf("failed to protect audit logs: %w", err)
+	}
+
 	// Check if db is init
 	if db == nil {
 		return nil, fmt.Errorf("failed to init database: %w", err)
@@ -54,3 +65,24 @@ func InitDB(cfg *config.Config) (*gorm.DB, error) {
 
 	return db, nil
 }
+
+// makeAppendOnly adds a trigger to table rejecting updates and deletes
+func makeAppendOnly(db *gorm.DB, table string) error {
+	function := table + "_append_only"
+	statements := []string{
+		fmt.Sprintf(`CREATE OR REPLACE FUNCTION %s() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION '%s is append-only';
+END
+$$ LANGUAGE plpgsql`, function, table),
+		fmt.Sprintf("DROP TRIGGER IF EXISTS append_only ON %s", table),
+		fmt.Sprintf("CREATE TRIGGER append_only BEFORE UPDATE OR DELETE ON %s FOR EACH ROW EXECUTE FUNCTION %s()", table, function),
+	}
+
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/nsvirk/moneybotstds/internal/config"
+	"github.com/nsvirk/moneybotstds/internal/tracing"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -23,12 +24,17 @@ func NewRedisClient(cfg *config.Config) (*RedisClient, error) {
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
+	rdb.AddHook(tracing.NewRedisHook())
+
 	return &RedisClient{rdb: rdb}, nil
 }
 
-func (c *RedisClient) PublishTicks(channel string, tickJSON []byte) error {
-	ctx := context.Background()
+// Ping checks the connection to Redis
+func (c *RedisClient) Ping(ctx context.Context) error {
+	return c.rdb.Ping(ctx).Err()
+}
 
+func (c *RedisClient) PublishTicks(ctx context.Context, channel string, tickJSON []byte) error {
 	err := c.rdb.Publish(ctx, channel, tickJSON).Err()
 	if err != nil {
 		return fmt.Errorf("failed to publish tick: %w", err)
@@ -37,6 +43,33 @@ func (c *RedisClient) PublishTicks(channel string, tickJSON []byte) error {
 	return nil
 }
 
+func (c *RedisClient) Publish(ctx context.Context, channel string, message []byte) error {
+	err := c.rdb.Publish(ctx, channel, message).Err()
+	if err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+
+	return nil
+}
+
+func (c *RedisClient) Set(ctx context.Context, key string, value []byte) error {
+	err := c.rdb.Set(ctx, key, value, 0).Err()
+	if err != nil {
+		return fmt.Errorf("failed to set key: %w", err)
+	}
+
+	return nil
+}
+
+func (c *RedisClient) Del(ctx context.Context, key string) error {
+	err := c.rdb.Del(ctx, key).Err()
+	if err != nil {
+		return fmt.Errorf("failed to delete key: %w", err)
+	}
+
+	return nil
+}
+
 func (c *RedisClient) Close() error {
 	return c.rdb.Close()
 }
@@ -1,8 +1,10 @@
 package repository
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/nsvirk/moneybotstds/internal/models"
 	"gorm.io/gorm"
@@ -17,6 +19,12 @@ func NewRepository(db *gorm.DB) *Repository {
 	return &Repository{db: db}
 }
 
+// WithContext returns a Repository running its queries with ctx, so they are
+// traced as part of the span in ctx
+func (r *Repository) WithContext(ctx context.Context) *Repository {
+	return &Repository{db: r.db.WithContext(ctx)}
+}
+
 // GetUser by userID
 func (r *Repository) GetUser(userID string) (*models.User, error) {
 	var user models.User
@@ -77,6 +85,50 @@ func (r *Repository) GetInstrumentToken(exchange, tradingsymbol string) (uint32,
 	return instrumentToken, nil
 }
 
+// GetInstrument - get an instrument by exchange and tradingsymbol
+func (r *Repository) GetInstrument(exchange, tradingsymbol string) (*models.Instrument, error) {
+	var instrument models.Instrument
+	err := r.db.Table(models.InstrumentsTable).
+		Where("exchange = ? AND tradingsymbol = ?", exchange, tradingsymbol).
+		First(&instrument).Error
+	if err != nil {
+		return nil, fmt.Errorf("error querying instrument %s:%s: %w", exchange, tradingsymbol, err)
+	}
+	return &instrument, nil
+}
+
+// GetInstrumentByToken - get an instrument by instrument token
+func (r *Repository) GetInstrumentByToken(instrumentToken uint32) (*models.Instrument, error) {
+	var instrument models.Instrument
+	err := r.db.Table(models.InstrumentsTable).
+		Where("instrument_token = ?", instrumentToken).
+		First(&instrument).Error
+	if err != nil {
+		return nil, fmt.Errorf("error querying instrument %d: %w", instrumentToken, err)
+	}
+	return &instrument, nil
+}
+
+// GetInstruments - get all instruments
+func (r *Repository) GetInstruments() ([]models.Instrument, error) {
+	var instruments []models.Instrument
+	err := r.db.Table(models.InstrumentsTable).Find(&instruments).Error
+	return instruments, err
+}
+
+// GetUnderlyingFuture - get the nearest future of `name` expiring on or after `expiry`
+func (r *Repository) GetUnderlyingFuture(exchange, name string, expiry time.Time) (*models.Instrument, error) {
+	var instrument models.Instrument
+	err := r.db.Table(models.InstrumentsTable).
+		Where("exchange = ? AND name = ? AND instrument_type = ? AND expiry >= ?", exchange, name, "FUT", expiry).
+		Order("expiry ASC").
+		First(&instrument).Error
+	if err != nil {
+		return nil, fmt.Errorf("error querying underlying future for %s:%s: %w", exchange, name, err)
+	}
+	return &instrument, nil
+}
+
 // GetTickerInstruments - get the instruments from the API
 func (r *Repository) GetTickerInstruments(botID, userID string) ([]models.TickerInstrument, error) {
 	var tickerInstruments []models.TickerInstrument
@@ -86,3 +138,345 @@ func (r *Repository) GetTickerInstruments(botID, userID string) ([]models.Ticker
 		Find(&tickerInstruments).Error
 	return tickerInstruments, err
 }
+
+// UpsertInstruments - insert or update instruments in batches
+func (r *Repository) UpsertInstruments(instruments []models.Instrument) error {
+	return r.db.Table(models.InstrumentsTable).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "instrument_token"}},
+		UpdateAll: true,
+	}).CreateInBatches(&instruments, 1000).Error
+}
+
+// DeleteExpiredInstruments - delete instruments that expired before `before`
+func (r *Repository) DeleteExpiredInstruments(before time.Time) (int64, error) {
+	result := r.db.Table(models.InstrumentsTable).
+		Where("expiry IS NOT NULL AND expiry < ?", before).
+		Delete(&models.Instrument{})
+	return result.RowsAffected, result.Error
+}
+
+// InsertInstrumentLoad - record an instruments refresh
+func (r *Repository) InsertInstrumentLoad(load *models.InstrumentLoad) error {
+	return r.db.Table(models.InstrumentLoadsTable).Create(load).Error
+}
+
+// GetLastInstrumentLoad - get the most recent instruments refresh
+func (r *Repository) GetLastInstrumentLoad() (*models.InstrumentLoad, error) {
+	var load models.InstrumentLoad
+	err := r.db.Table(models.InstrumentLoadsTable).Order("loaded_at DESC").First(&load).Error
+	return &load, err
+}
+
+// InsertAPIKey - insert an api key
+func (r *Repository) InsertAPIKey(apiKey *models.APIKey) error {
+	return r.db.Table(models.APIKeysTable).Create(apiKey).Error
+}
+
+// GetAPIKey - get an api key that is not revoked
+func (r *Repository) GetAPIKey(apiKey string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.db.Table(models.APIKeysTable).
+		Where("api_key = ? AND revoked_at IS NULL", apiKey).
+		First(&key).Error
+	return &key, err
+}
+
+// GetAPIKeys - get the api keys of a user that are not revoked
+func (r *Repository) GetAPIKeys(userID string) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := r.db.Table(models.APIKeysTable).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at ASC").
+		Find(&keys).Error
+	return keys, err
+}
+
+// RevokeAPIKey - revoke an api key of a user
+func (r *Repository) RevokeAPIKey(userID, apiKey string, revokedAt time.Time) (int64, error) {
+	result := r.db.Table(models.APIKeysTable).
+		Where("user_id = ? AND api_key = ? AND revoked_at IS NULL", userID, apiKey).
+		Update("revoked_at", revokedAt)
+	return result.RowsAffected, result.Error
+}
+
+// UpdateAPIKeyLastUsed - set the last used time of an api key
+func (r *Repository) UpdateAPIKeyLastUsed(id uint32, lastUsedAt time.Time) error {
+	return r.db.Table(models.APIKeysTable).Where("id = ?", id).Update("last_used_at", lastUsedAt).Error
+}
+
+// UpsertCredential - insert or update the credential of a user
+func (r *Repository) UpsertCredential(credential *models.Credential) error {
+	return r.db.Table(models.CredentialsTable).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"key_id", "ciphertext", "updated_at"}),
+	}).Create(credential).Error
+}
+
+// GetCredential - get the credential of a user
+func (r *Repository) GetCredential(userID string) (*models.Credential, error) {
+	var credential models.Credential
+	err := r.db.Table(models.CredentialsTable).Where("user_id = ?", userID).First(&credential).Error
+	return &credential, err
+}
+
+// GetCredentialsNotEncryptedWith - get the credentials encrypted with a key other than keyID
+func (r *Repository) GetCredentialsNotEncryptedWith(keyID string) ([]models.Credential, error) {
+	var credentials []models.Credential
+	err := r.db.Table(models.CredentialsTable).Where("key_id <> ?", keyID).Find(&credentials).Error
+	return credentials, err
+}
+
+// DeleteCredential - delete the credential of a user
+func (r *Repository) DeleteCredential(userID string) error {
+	return r.db.Table(models.CredentialsTable).Where("user_id = ?", userID).Delete(&models.Credential{}).Error
+}
+
+// UpsertTicker - insert or update the state of a ticker
+func (r *Repository) UpsertTicker(ticker *models.Ticker) error {
+	return r.db.Table(models.TickersTable).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "bot_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "options", "started_at", "stopped_at", "updated_at"}),
+	}).Create(ticker).Error
+}
+
+// UpdateTickerStatus - set the status of a ticker
+func (r *Repository) UpdateTickerStatus(userID, botID, status string, stoppedAt *time.Time) error {
+	return r.db.Table(models.TickersTable).
+		Where("user_id = ? AND bot_id = ?", userID, botID).
+		Updates(map[string]interface{}{"status": status, "stopped_at": stoppedAt, "updated_at": time.Now()}).Error
+}
+
+// GetTickersByStatus - get the tickers with a status
+func (r *Repository) GetTickersByStatus(status string) ([]models.Ticker, error) {
+	var tickers []models.Ticker
+	err := r.db.Table(models.TickersTable).Where("status = ?", status).Find(&tickers).Error
+	return tickers, err
+}
+
+// GetTicker - get the state of a ticker
+func (r *Repository) GetTicker(userID, botID string) (*models.Ticker, error) {
+	var ticker models.Ticker
+	err := r.db.Table(models.TickersTable).Where("user_id = ? AND bot_id = ?", userID, botID).First(&ticker).Error
+	if err != nil {
+		return nil, err
+	}
+	return &ticker, nil
+}
+
+// InsertWebhook - insert a webhook
+func (r *Repository) InsertWebhook(webhook *models.Webhook) error {
+	return r.db.Table(models.WebhooksTable).Create(webhook).Error
+}
+
+// GetWebhook - get a webhook of a user
+func (r *Repository) GetWebhook(userID string, id uint32) (*models.Webhook, error) {
+	var webhook models.Webhook
+	err := r.db.Table(models.WebhooksTable).Where("user_id = ? AND id = ?", userID, id).First(&webhook).Error
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// GetWebhooks - get the webhooks of a user
+func (r *Repository) GetWebhooks(userID string) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	err := r.db.Table(models.WebhooksTable).Where("user_id = ?", userID).Order("id").Find(&webhooks).Error
+	return webhooks, err
+}
+
+// GetBotWebhooks - get the webhooks of a bot, including those of all bots of the user
+func (r *Repository) GetBotWebhooks(userID, botID string) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	err := r.db.Table(models.WebhooksTable).
+		Where("user_id = ? AND (bot_id = '' OR bot_id = ?)", userID, botID).
+		Find(&webhooks).Error
+	return webhooks, err
+}
+
+// DeleteWebhook - delete a webhook of a user, returning the number of webhooks deleted
+func (r *Repository) DeleteWebhook(userID string, id uint32) (int64, error) {
+	result := r.db.Table(models.WebhooksTable).Where("user_id = ? AND id = ?", userID, id).Delete(&models.Webhook{})
+	return result.RowsAffected, result.Error
+}
+
+// InsertWebhookDelivery - insert a webhook delivery attempt
+func (r *Repository) InsertWebhookDelivery(delivery *models.WebhookDelivery) error {
+	return r.db.Table(models.WebhookDeliveriesTable).Create(delivery).Error
+}
+
+// GetWebhookDeliveries - get the latest delivery attempts of a webhook
+func (r *Repository) GetWebhookDeliveries(webhookID uint32, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := r.db.Table(models.WebhookDeliveriesTable).
+		Where("webhook_id = ?", webhookID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+// GetQuota - get the quota of a user
+func (r *Repository) GetQuota(userID string) (*models.Quota, error) {
+	var quota models.Quota
+	err := r.db.Table(models.QuotasTable).Where("user_id = ?", userID).First(&quota).Error
+	if err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
+// UpsertQuota - insert or update the quota of a user
+func (r *Repository) UpsertQuota(quota *models.Quota) error {
+	return r.db.Table(models.QuotasTable).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"max_bots", "max_instruments_per_bot", "max_instruments", "max_calls_per_minute", "updated_at"}),
+	}).Create(quota).Error
+}
+
+// GetTickers - get the state of all tickers, with a status if set
+func (r *Repository) GetTickers(status string) ([]models.Ticker, error) {
+	var tickers []models.Ticker
+	query := r.db.Table(models.TickersTable)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("user_id, bot_id").Find(&tickers).Error
+	return tickers, err
+}
+
+// GetTickerLogs - get the latest ticker logs, filtered by the fields set in
+// filter and by time if since or until are set. If beforeID is set only older
+// rows are returned, to page through the logs
+func (r *Repository) GetTickerLogs(filter models.TickerLog, since, until time.Time, beforeID uint32, limit int) ([]models.TickerLog, error) {
+	var tickerLogs []models.TickerLog
+	query := r.tickerLogsQuery(filter)
+	if !since.IsZero() {
+		query = query.Where("timestamp >= ?", since)
+	}
+	if !until.IsZero() {
+		query = query.Where("timestamp < ?", until)
+	}
+	if beforeID > 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+	err := query.Order("id DESC").Limit(limit).Find(&tickerLogs).Error
+	return tickerLogs, err
+}
+
+// GetTickerLogsAfter - get the ticker logs newer than afterID, filtered by the
+// fields set in filter, oldest first
+func (r *Repository) GetTickerLogsAfter(filter models.TickerLog, afterID uint32, limit int) ([]models.TickerLog, error) {
+	var tickerLogs []models.TickerLog
+	err := r.tickerLogsQuery(filter).Where("id > ?", afterID).Order("id").Limit(limit).Find(&tickerLogs).Error
+	return tickerLogs, err
+}
+
+// GetLastTickerLogID - get the id of the latest ticker log, 0 if there are none
+func (r *Repository) GetLastTickerLogID() (uint32, error) {
+	var id uint32
+	err := r.db.Table(models.TickerLogsTable).Select("COALESCE(MAX(id), 0)").Scan(&id).Error
+	return id, err
+}
+
+func (r *Repository) tickerLogsQuery(filter models.TickerLog) *gorm.DB {
+	query := r.db.Table(models.TickerLogsTable)
+	if filter.UserID != "" {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.BotID != "" {
+		query = query.Where("bot_id = ?", filter.BotID)
+	}
+	if filter.Level != "" {
+		query = query.Where("level = ?", filter.Level)
+	}
+	if filter.EventType != "" {
+		query = query.Where("event_type = ?", filter.EventType)
+	}
+	return query
+}
+
+// PruneLogs - delete up to limit rows of a logs table older than before,
+// oldest first. If level is set only rows with the level are deleted,
+// otherwise rows with the excluded levels are kept. The deleted rows are
+// passed to archive before the deletion is committed, and kept if it fails
+func (r *Repository) PruneLogs(table string, before time.Time, level string, excludeLevels []string, limit int, archive func(rows []map[string]interface{}) error) (int, error) {
+	where := "timestamp < ?"
+	args := []interface{}{before}
+	if level != "" {
+		where += " AND level = ?"
+		args = append(args, level)
+	} else if len(excludeLevels) > 0 {
+		where += " AND level NOT IN ?"
+		args = append(args, excludeLevels)
+	}
+	args = append(args, limit)
+
+	sql := fmt.Sprintf("DELETE FROM %s WHERE id IN (SELECT id FROM %s WHERE %s ORDER BY id LIMIT ?) RETURNING *", table, table, where)
+
+	var rows []map[string]interface{}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Raw(sql, args...).Scan(&rows).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 || archive == nil {
+			return nil
+		}
+		return archive(rows)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// GetLogs - get the latest app logs, with a level if set
+func (r *Repository) GetLogs(level string, limit int) ([]models.Log, error) {
+	var logs []models.Log
+	query := r.db.Table(models.LogsTable)
+	if level != "" {
+		query = query.Where("level = ?", level)
+	}
+	err := query.Order("id DESC").Limit(limit).Find(&logs).Error
+	return logs, err
+}
+
+// InsertAuditLog - insert an audit log
+func (r *Repository) InsertAuditLog(auditLog *models.AuditLog) error {
+	return r.db.Table(models.AuditLogsTable).Create(auditLog).Error
+}
+
+// GetAuditLogs - get the latest audit logs of a user and bot if set, between from and to if set
+func (r *Repository) GetAuditLogs(userID, botID string, from, to time.Time, limit int) ([]models.AuditLog, error) {
+	var auditLogs []models.AuditLog
+	query := r.db.Table(models.AuditLogsTable)
+	if userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if botID != "" {
+		query = query.Where("bot_id = ?", botID)
+	}
+	if !from.IsZero() {
+		query = query.Where("timestamp >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("timestamp < ?", to)
+	}
+	err := query.Order("id DESC").Limit(limit).Find(&auditLogs).Error
+	return auditLogs, err
+}
+
+// UpsertMarketHolidays - insert or update market holidays by date and exchange
+func (r *Repository) UpsertMarketHolidays(holidays []models.MarketHoliday) error {
+	return r.db.Table(models.MarketHolidaysTable).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "date"}, {Name: "exchange"}},
+		DoUpdates: clause.AssignmentColumns([]string{"sessions", "description"}),
+	}).Create(&holidays).Error
+}
+
+// GetMarketHolidays - get the market holidays on or after since
+func (r *Repository) GetMarketHolidays(since time.Time) ([]models.MarketHoliday, error) {
+	var holidays []models.MarketHoliday
+	err := r.db.Table(models.MarketHolidaysTable).Where("date >= ?", since).Order("date, exchange").Find(&holidays).Error
+	return holidays, err
+}
@@ -0,0 +1,103 @@
+// Package secrets encrypts secrets at rest with AES-256-GCM under a set of
+// named keys, so keys can be rotated without losing existing ciphertexts
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Keyring holds the encryption keys by ID. New secrets are encrypted with the
+// active key, existing ones are decrypted with the key they were encrypted with
+type Keyring struct {
+	activeID string
+	aeads    map[string]cipher.AEAD
+}
+
+// NewKeyring parses a key spec of comma separated `<key_id>:<base64 key>`
+// pairs, each key 32 bytes. The first key is the active key
+func NewKeyring(spec string) (*Keyring, error) {
+	k := &Keyring{aeads: make(map[string]cipher.AEAD)}
+
+	for _, entry := range strings.Split(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid key entry, expected <key_id>:<base64 key>")
+		}
+		if _, exists := k.aeads[id]; exists {
+			return nil, fmt.Errorf("duplicate key id: %s", id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %s is not valid base64: %w", id, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %s must be 32 bytes, got %d", id, len(key))
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+
+		if k.activeID == "" {
+			k.activeID = id
+		}
+		k.aeads[id] = aead
+	}
+
+	return k, nil
+}
+
+// ActiveKeyID returns the ID of the key new secrets are encrypted with
+func (k *Keyring) ActiveKeyID() string {
+	return k.activeID
+}
+
+// Encrypt encrypts plaintext with the active key. additionalData is
+// authenticated but not encrypted, and must be passed again to Decrypt.
+// It returns the ID of the key used and the base64 nonce and ciphertext
+func (k *Keyring) Encrypt(plaintext, additionalData string) (string, string, error) {
+	aead := k.aeads[k.activeID]
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(additionalData))
+	return k.activeID, base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a ciphertext returned by Encrypt with the key keyID
+func (k *Keyring) Decrypt(keyID, ciphertext, additionalData string) (string, error) {
+	aead, ok := k.aeads[keyID]
+	if !ok {
+		return "", fmt.Errorf("unknown key id: %s", keyID)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("invalid ciphertext: %w", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("invalid ciphertext: too short")
+	}
+
+	nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, []byte(additionalData))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt: %w", err)
+	}
+
+	return string(plaintext), nil
+}
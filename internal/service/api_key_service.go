@@ -0,0 +1,146 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nsvirk/moneybotstds/internal/models"
+	"github.com/nsvirk/moneybotstds/internal/repository"
+	"gorm.io/gorm"
+)
+
+// API key scopes
+const (
+	ScopePublishStart = "publish:start"
+	ScopePublishStop  = "publish:stop"
+	ScopeTicksRead    = "ticks:read"
+)
+
+// AllScopes are the scopes an API key can be granted
+var AllScopes = []string{ScopePublishStart, ScopePublishStop, ScopeTicksRead}
+
+// ErrInvalidAPIKey is returned when an API key or secret does not match
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// ErrUnknownScope is returned when creating an API key with an unknown scope
+var ErrUnknownScope = errors.New("unknown scope")
+
+// How often the last used time of an API key is written
+const apiKeyLastUsedInterval = time.Minute
+
+// APIKeyService mints and verifies service-issued API keys
+type APIKeyService struct {
+	repo *repository.Repository
+}
+
+// NewAPIKeyService creates a new APIKeyService
+func NewAPIKeyService(db *gorm.DB) *APIKeyService {
+	return &APIKeyService{repo: repository.NewRepository(db)}
+}
+
+// CreateAPIKey mints a new API key for the user with the given scopes, all
+// scopes if none are given. The secret is returned only here, only its hash
+// is stored
+func (s *APIKeyService) CreateAPIKey(userID, name string, scopes []string) (*models.APIKey, string, error) {
+	if len(scopes) == 0 {
+		scopes = AllScopes
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(AllScopes, scope) {
+			return nil, "", fmt.Errorf("%w: %s", ErrUnknownScope, scope)
+		}
+	}
+
+	apiKey, err := randomHex(8)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := &models.APIKey{
+		UserID:     userID,
+		APIKey:     "mbk_" + apiKey,
+		SecretHash: hashSecret(secret),
+		Name:       name,
+		Scopes:     strings.Join(scopes, ","),
+		CreatedAt:  time.Now(),
+	}
+	if err := s.repo.InsertAPIKey(key); err != nil {
+		return nil, "", fmt.Errorf("failed to store api key: %w", err)
+	}
+
+	return key, secret, nil
+}
+
+// Verify returns the API key if the secret matches, or ErrInvalidAPIKey
+func (s *APIKeyService) Verify(apiKey, secret string) (*models.APIKey, error) {
+	key, err := s.repo.GetAPIKey(apiKey)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.SecretHash), []byte(hashSecret(secret))) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyLastUsedInterval {
+		if err := s.repo.UpdateAPIKeyLastUsed(key.ID, now); err == nil {
+			key.LastUsedAt = &now
+		}
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys returns the active API keys of a user
+func (s *APIKeyService) ListAPIKeys(userID string) ([]models.APIKey, error) {
+	return s.repo.GetAPIKeys(userID)
+}
+
+// RevokeAPIKey revokes an API key of a user, returning ErrInvalidAPIKey if the
+// user has no such active key
+func (s *APIKeyService) RevokeAPIKey(userID, apiKey string) error {
+	revoked, err := s.repo.RevokeAPIKey(userID, apiKey, time.Now())
+	if err != nil {
+		return err
+	}
+	if revoked == 0 {
+		return ErrInvalidAPIKey
+	}
+	return nil
+}
+
+// APIKeyScopes returns the scopes of an API key
+func APIKeyScopes(key *models.APIKey) []string {
+	if key.Scopes == "" {
+		return nil
+	}
+	return strings.Split(key.Scopes, ",")
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nsvirk/moneybotstds/internal/logger"
+	"github.com/nsvirk/moneybotstds/internal/models"
+	"github.com/nsvirk/moneybotstds/internal/repository"
+	"gorm.io/gorm"
+)
+
+// Audit actors
+const (
+	AuditActorUser  = "user"
+	AuditActorAdmin = "admin"
+)
+
+// Audit log query limits
+const (
+	DefaultAuditLimit = 100
+	MaxAuditLimit     = 1000
+)
+
+// Request body fields never written to the audit log
+var auditRedactedFields = []string{"enctoken", "secret", "api_secret", "password", "token"}
+
+// Longest list and string kept whole in an audit summary
+const (
+	auditMaxListItems   = 5
+	auditMaxStringBytes = 256
+	auditMaxSummary     = 2048
+)
+
+// AuditQuery filters the audit logs
+type AuditQuery struct {
+	UserID string
+	BotID  string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+// AuditService records API actions in the append-only audit_logs table
+type AuditService struct {
+	repo *repository.Repository
+}
+
+// NewAuditService creates a new AuditService
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{repo: repository.NewRepository(db)}
+}
+
+// Record writes an audit log. Failures are logged, the action already happened
+func (s *AuditService) Record(auditLog *models.AuditLog) {
+	if err := s.repo.InsertAuditLog(auditLog); err != nil {
+		slog.Error("Failed to write audit log", "action", auditLog.Action, logger.KeyUserID, auditLog.UserID, "error", err)
+	}
+}
+
+// Query returns the latest audit logs matching query, newest first
+func (s *AuditService) Query(query AuditQuery) ([]models.AuditLog, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultAuditLimit
+	}
+	limit = min(limit, MaxAuditLimit)
+
+	return s.repo.GetAuditLogs(query.UserID, query.BotID, query.From, query.To, limit)
+}
+
+// SummarizeRequestBody makes the audit summary of a JSON request body. Secret
+// fields are redacted, long lists are replaced by their first items and count
+// and long strings are truncated. Bodies that are not JSON objects are only
+// described by their size
+func SummarizeRequestBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return fmt.Sprintf("<%d bytes>", len(body))
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := fields[key]
+		if slices.Contains(auditRedactedFields, strings.ToLower(key)) {
+			value = "<redacted>"
+		}
+		parts = append(parts, key+"="+summarizeValue(value))
+	}
+
+	summary := strings.Join(parts, " ")
+	if len(summary) > auditMaxSummary {
+		summary = summary[:auditMaxSummary] + "..."
+	}
+	return summary
+}
+
+func summarizeValue(value interface{}) string {
+	switch v := value.(type) {
+	case []interface{}:
+		items := make([]string, 0, min(len(v), auditMaxListItems))
+		for _, item := range v[:min(len(v), auditMaxListItems)] {
+			items = append(items, summarizeValue(item))
+		}
+		if len(v) > auditMaxListItems {
+			return fmt.Sprintf("[%s ... %d items]", strings.Join(items, ","), len(v))
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	case string:
+		if len(v) > auditMaxStringBytes {
+			return v[:auditMaxStringBytes] + "..."
+		}
+		return v
+	case nil:
+		return "null"
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSummarizeRequestBody(t *testing.T) {
+	long := strings.Repeat("a", auditMaxStringBytes+10)
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "empty",
+			body: "",
+			want: "",
+		},
+		{
+			name: "sorted fields",
+			body: `{"bot_id":"BOT1","enrich_greeks":true,"metadata":null,"quota":3}`,
+			want: "bot_id=BOT1 enrich_greeks=true metadata=null quota=3",
+		},
+		{
+			name: "redacted fields",
+			body: `{"Enctoken":"abc","api_secret":"def","password":"ghi","secret":"jkl","token":"mno","name":"bot"}`,
+			want: "Enctoken=<redacted> api_secret=<redacted> name=bot password=<redacted> secret=<redacted> token=<redacted>",
+		},
+		{
+			name: "short list",
+			body: `{"ticker_instruments":["NSE:INFY","NSE:TCS"]}`,
+			want: "ticker_instruments=[NSE:INFY,NSE:TCS]",
+		},
+		{
+			name: "long list",
+			body: `{"ticker_instruments":["A","B","C","D","E","F","G"]}`,
+			want: "ticker_instruments=[A,B,C,D,E ... 7 items]",
+		},
+		{
+			name: "long string",
+			body: `{"name":"` + long + `"}`,
+			want: "name=" + long[:auditMaxStringBytes] + "...",
+		},
+		{
+			name: "nested object",
+			body: `{"schedule":{"before_open":"10m"}}`,
+			want: `schedule={"before_open":"10m"}`,
+		},
+		{
+			name: "not an object",
+			body: `["BOT1"]`,
+			want: "<8 bytes>",
+		},
+		{
+			name: "not json",
+			body: "bot_id=BOT1",
+			want: "<11 bytes>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SummarizeRequestBody([]byte(tt.body)); got != tt.want {
+				t.Errorf("SummarizeRequestBody() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummarizeRequestBodyTruncated(t *testing.T) {
+	// Many fields of long strings make a summary over the limit
+	var fields []string
+	for i := range 20 {
+		fields = append(fields, `"field_`+string(rune('a'+i))+`":"`+strings.Repeat("x", auditMaxStringBytes)+`"`)
+	}
+	body := "{" + strings.Join(fields, ",") + "}"
+
+	got := SummarizeRequestBody([]byte(body))
+	if len(got) != auditMaxSummary+len("...") || !strings.HasSuffix(got, "...") {
+		t.Errorf("SummarizeRequestBody() returned %d bytes, want %d ending in ...", len(got), auditMaxSummary+3)
+	}
+	if !strings.HasPrefix(got, "field_a=xxx") {
+		t.Errorf("SummarizeRequestBody() = %.20q..., want it to start with field_a", got)
+	}
+}
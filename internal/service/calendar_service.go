@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nsvirk/moneybotstds/internal/config"
+	"github.com/nsvirk/moneybotstds/internal/logger"
+	"github.com/nsvirk/moneybotstds/internal/market"
+	"github.com/nsvirk/moneybotstds/internal/models"
+	"github.com/nsvirk/moneybotstds/internal/repository"
+	"gorm.io/gorm"
+)
+
+// calendarReloadInterval is how often the holidays are reloaded from the table
+const calendarReloadInterval = time.Hour
+
+// holidaysHeader is the header of the holidays CSV file
+var holidaysHeader = []string{"date", "exchange", "sessions", "description"}
+
+// CalendarService keeps the exchange calendar with the holidays stored in the
+// market holidays table
+type CalendarService struct {
+	repo      *repository.Repository
+	calendar  *market.Calendar
+	appLogger *logger.AppLogger
+}
+
+// NewCalendarService creates a new CalendarService. The holidays of the
+// configured file, if any, are imported into the table and the calendar is
+// loaded from it
+func NewCalendarService(cfg *config.Config, db *gorm.DB) (*CalendarService, error) {
+	s := &CalendarService{
+		repo:      repository.NewRepository(db),
+		calendar:  market.NewCalendar(),
+		appLogger: logger.NewAppLogger(db),
+	}
+
+	if cfg.HolidaysFile != "" {
+		n, err := s.ImportHolidays(cfg.HolidaysFile)
+		if err != nil {
+			return nil, err
+		}
+		s.appLogger.Info("Holidays imported", "file", cfg.HolidaysFile, "holidays", n)
+	}
+
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Calendar returns the exchange calendar
+func (s *CalendarService) Calendar() *market.Calendar {
+	return s.calendar
+}
+
+// ImportHolidays stores the holidays of a CSV file with a `date,exchange,
+// sessions,description` header, returning the number stored. Dates are
+// YYYY-MM-DD and sessions are separated by `|`, an empty sessions column
+// closing the exchange all day
+func (s *CalendarService) ImportHolidays(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open holidays file: %w", err)
+	}
+	defer f.Close()
+
+	holidays, err := ParseHolidays(f)
+	if err != nil {
+		return 0, fmt.Errorf("invalid holidays file %s: %w", path, err)
+	}
+	if len(holidays) == 0 {
+		return 0, nil
+	}
+
+	if err := s.repo.UpsertMarketHolidays(holidays); err != nil {
+		return 0, fmt.Errorf("failed to store holidays: %w", err)
+	}
+	return len(holidays), nil
+}
+
+// ParseHolidays parses holidays in the CSV format of ImportHolidays
+func ParseHolidays(r io.Reader) ([]models.MarketHoliday, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(holidaysHeader)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range holidaysHeader {
+		if strings.ToLower(strings.TrimSpace(header[i])) != name {
+			return nil, fmt.Errorf("header must be %s", strings.Join(holidaysHeader, ","))
+		}
+	}
+
+	var holidays []models.MarketHoliday
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		date, err := time.ParseInLocation(time.DateOnly, strings.TrimSpace(record[0]), time.UTC)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid date %s", line, record[0])
+		}
+
+		exchange := strings.ToUpper(strings.TrimSpace(record[1]))
+		if !slices.Contains(market.Exchanges(), exchange) {
+			return nil, fmt.Errorf("line %d: unknown exchange %s", line, record[1])
+		}
+
+		var sessions []string
+		for _, session := range strings.Split(record[2], "|") {
+			if session = strings.ToLower(strings.TrimSpace(session)); session == "" {
+				continue
+			}
+			if !slices.Contains(market.SessionNames(exchange), session) {
+				return nil, fmt.Errorf("line %d: unknown %s session %s", line, exchange, session)
+			}
+			sessions = append(sessions, session)
+		}
+
+		holidays = append(holidays, models.MarketHoliday{
+			Date:        date,
+			Exchange:    exchange,
+			Sessions:    strings.Join(sessions, ","),
+			Description: strings.TrimSpace(record[3]),
+		})
+	}
+
+	return holidays, nil
+}
+
+// Reload loads the holidays from the table into the calendar
+func (s *CalendarService) Reload() error {
+	// Tickers look back a day when scheduling
+	since := time.Now().In(market.IST).AddDate(0, 0, -2)
+	rows, err := s.repo.GetMarketHolidays(time.Date(since.Year(), since.Month(), since.Day(), 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		return fmt.Errorf("failed to get holidays: %w", err)
+	}
+
+	holidays := make([]market.Holiday, 0, len(rows))
+	for _, row := range rows {
+		holiday := market.Holiday{
+			// Dates are stored without a zone
+			Date:     time.Date(row.Date.Year(), row.Date.Month(), row.Date.Day(), 0, 0, 0, 0, market.IST),
+			Exchange: row.Exchange,
+		}
+		if row.Sessions != "" {
+			holiday.Sessions = strings.Split(row.Sessions, ",")
+		}
+		holidays = append(holidays, holiday)
+	}
+	s.calendar.SetHolidays(holidays)
+
+	return nil
+}
+
+// RunReloadJob reloads the calendar hourly until ctx is cancelled, so holidays
+// added to the table are picked up
+func (s *CalendarService) RunReloadJob(ctx context.Context) {
+	ticker := time.NewTicker(calendarReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Reload(); err != nil {
+				s.appLogger.Error("Failed to reload the exchange calendar", "error", err)
+			}
+		}
+	}
+}
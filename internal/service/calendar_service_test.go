@@ -0,0 +1,98 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nsvirk/moneybotstds/internal/models"
+)
+
+func TestParseHolidays(t *testing.T) {
+	day := func(value string) time.Time {
+		d, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	tests := []struct {
+		name    string
+		csv     string
+		want    []models.MarketHoliday
+		wantErr string
+	}{
+		{
+			name: "holidays",
+			csv: "date,exchange,sessions,description\n" +
+				"2025-02-26,NSE,,Mahashivratri\n" +
+				"2025-02-26, mcx, Morning ,Mahashivratri\n" +
+				"2025-03-14,MCX,morning|evening,Holi\n",
+			want: []models.MarketHoliday{
+				{Date: day("2025-02-26"), Exchange: "NSE", Description: "Mahashivratri"},
+				{Date: day("2025-02-26"), Exchange: "MCX", Sessions: "morning", Description: "Mahashivratri"},
+				{Date: day("2025-03-14"), Exchange: "MCX", Sessions: "morning,evening", Description: "Holi"},
+			},
+		},
+		{
+			name: "header case",
+			csv:  "Date,Exchange,Sessions,Description\n2025-02-26,BSE,,Mahashivratri\n",
+			want: []models.MarketHoliday{
+				{Date: day("2025-02-26"), Exchange: "BSE", Description: "Mahashivratri"},
+			},
+		},
+		{
+			name: "empty file",
+			csv:  "",
+		},
+		{
+			name: "header only",
+			csv:  "date,exchange,sessions,description\n",
+		},
+		{
+			name:    "wrong header",
+			csv:     "day,exchange,sessions,description\n",
+			wantErr: "header must be date,exchange,sessions,description",
+		},
+		{
+			name:    "invalid date",
+			csv:     "date,exchange,sessions,description\n26-02-2025,NSE,,Mahashivratri\n",
+			wantErr: "line 2: invalid date 26-02-2025",
+		},
+		{
+			name:    "unknown exchange",
+			csv:     "date,exchange,sessions,description\n2025-02-26,NYSE,,Mahashivratri\n",
+			wantErr: "line 2: unknown exchange NYSE",
+		},
+		{
+			name:    "unknown session",
+			csv:     "date,exchange,sessions,description\n2025-02-26,NSE,morning,Mahashivratri\n",
+			wantErr: "line 2: unknown NSE session morning",
+		},
+		{
+			name:    "missing column",
+			csv:     "date,exchange,sessions,description\n2025-02-26,NSE,\n",
+			wantErr: "wrong number of fields",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseHolidays(strings.NewReader(tt.csv))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseHolidays() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseHolidays() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseHolidays() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nsvirk/moneybotstds/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrCredentialsDisabled is returned when no credentials key is configured
+	ErrCredentialsDisabled = errors.New("credential storage is not configured")
+	// ErrNoCredential is returned when a user has no stored enctoken
+	ErrNoCredential = errors.New("no enctoken registered")
+)
+
+// SaveCredential encrypts the enctoken of a user with the active key and
+// stores it, so the ticker can be started without the enctoken later
+func (s *TickerService) SaveCredential(userID, enctoken string) error {
+	if s.keyring == nil {
+		return ErrCredentialsDisabled
+	}
+
+	keyID, ciphertext, err := s.keyring.Encrypt(enctoken, userID)
+	if err != nil {
+		return err
+	}
+
+	credential := models.Credential{
+		UserID:     userID,
+		KeyID:      keyID,
+		Ciphertext: ciphertext,
+	}
+	if err := s.repo.UpsertCredential(&credential); err != nil {
+		return fmt.Errorf("failed to store credential: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveCredential deletes the stored enctoken of a user
+func (s *TickerService) RemoveCredential(userID string) error {
+	if err := s.repo.DeleteCredential(userID); err != nil {
+		return fmt.Errorf("failed to delete credential: %w", err)
+	}
+	return nil
+}
+
+// RotateCredentials re-encrypts every credential not encrypted with the active
+// key, returning the number of credentials re-encrypted
+func (s *TickerService) RotateCredentials() (int, error) {
+	if s.keyring == nil {
+		return 0, ErrCredentialsDisabled
+	}
+
+	credentials, err := s.repo.GetCredentialsNotEncryptedWith(s.keyring.ActiveKeyID())
+	if err != nil {
+		return 0, fmt.Errorf("failed to get credentials: %w", err)
+	}
+
+	rotated := 0
+	for _, credential := range credentials {
+		enctoken, err := s.keyring.Decrypt(credential.KeyID, credential.Ciphertext, credential.UserID)
+		if err != nil {
+			return rotated, fmt.Errorf("failed to decrypt credential of %s: %w", credential.UserID, err)
+		}
+		if err := s.SaveCredential(credential.UserID, enctoken); err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+
+	return rotated, nil
+}
+
+// loadEnctoken decrypts the stored enctoken of a user
+func (s *TickerService) loadEnctoken(ctx context.Context, userID string) (string, error) {
+	if s.keyring == nil {
+		return "", ErrCredentialsDisabled
+	}
+
+	credential, err := s.repo.WithContext(ctx).GetCredential(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrNoCredential
+		}
+		return "", fmt.Errorf("failed to get credential: %w", err)
+	}
+
+	return s.keyring.Decrypt(credential.KeyID, credential.Ciphertext, credential.UserID)
+}
@@ -11,18 +11,19 @@ import (
 )
 
 type DBService struct {
-	repo *repository.Repository
+	repo            *repository.Repository
+	instrumentCache *InstrumentCache
 }
 
-func NewDBService(db *gorm.DB) *DBService {
-	return &DBService{repo: repository.NewRepository(db)}
+func NewDBService(db *gorm.DB, instrumentCache *InstrumentCache) *DBService {
+	return &DBService{repo: repository.NewRepository(db), instrumentCache: instrumentCache}
 }
 
 func (s *DBService) SaveUserConnection(userID, enctoken string, instrumentCt int) error {
 	// Create a new user
 	user := models.User{
 		UserID:        userID,
-		Enctoken:      enctoken[0:8] + "******",
+		Enctoken:      maskEnctoken(enctoken),
 		InstrumentsCt: instrumentCt,
 		ConnectedAt:   time.Now(),
 	}
@@ -39,12 +40,12 @@ func (s *DBService) MakeTickerInstrumentTokenMap(tickerInstruments []string) (ma
 		}
 		exchange, tradingsymbol := parts[0], parts[1]
 
-		instrumentToken, err := s.repo.GetInstrumentToken(exchange, tradingsymbol)
+		inst, err := s.instrumentCache.Lookup(exchange, tradingsymbol)
 		if err != nil {
 			return nil, fmt.Errorf("error querying instrument token: %w", err)
 		}
 
-		instrumentTokenMap[instrument] = instrumentToken
+		instrumentTokenMap[instrument] = inst.InstrumentToken
 	}
 
 	return instrumentTokenMap, nil
@@ -87,3 +88,11 @@ func (s *DBService) SetTickerInstruments(botID, userID string, instrumentTokenMa
 func (s *DBService) GetTickerInstruments(botID, userID string) ([]models.TickerInstrument, error) {
 	return s.repo.GetTickerInstruments(botID, userID)
 }
+
+// maskEnctoken keeps the first 8 characters of an enctoken
+func maskEnctoken(enctoken string) string {
+	if len(enctoken) < 8 {
+		return "******"
+	}
+	return enctoken[0:8] + "******"
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nsvirk/moneybotstds/internal/metrics"
+)
+
+// Recovery actions of stale feeds
+const (
+	FeedRecoveryOff         = "off"
+	FeedRecoveryResubscribe = "resubscribe"
+	FeedRecoveryReconnect   = "reconnect"
+)
+
+// feedWatch is the last tick times of a ticker, written by the ticker
+// goroutine and read by the watchdog
+type feedWatch struct {
+	mu          sync.Mutex
+	connectedAt time.Time
+	lastTick    time.Time
+	lastTicks   map[uint32]time.Time
+
+	// The stale instruments and connection, only used by the watchdog
+	stale     map[uint32]*staleFeed
+	connStale *staleFeed
+}
+
+// staleFeed is an instrument or connection flagged stale
+type staleFeed struct {
+	flaggedAt   time.Time
+	recoveredAt time.Time // last recovery attempt
+}
+
+func newFeedWatch() *feedWatch {
+	return &feedWatch{
+		lastTicks: make(map[uint32]time.Time),
+		stale:     make(map[uint32]*staleFeed),
+	}
+}
+
+// tick records a tick of token received at
+func (w *feedWatch) tick(token uint32, at time.Time) {
+	w.mu.Lock()
+	w.lastTick = at
+	w.lastTicks[token] = at
+	w.mu.Unlock()
+}
+
+// connected records a connection to Kite, instruments are given time to tick
+// after it before they are stale
+func (w *feedWatch) connected(at time.Time) {
+	w.mu.Lock()
+	w.connectedAt = at
+	w.mu.Unlock()
+}
+
+// RunFeedWatchdog checks the feeds of the running tickers every interval
+// until ctx is cancelled
+func (s *TickerService) RunFeedWatchdog(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.checkFeeds(now)
+		}
+	}
+}
+
+func (s *TickerService) checkFeeds(now time.Time) {
+	s.mu.Lock()
+	instances := make([]*TickerInstance, 0, len(s.tickers))
+	for _, instance := range s.tickers {
+		instances = append(instances, instance)
+	}
+	s.mu.Unlock()
+
+	for _, instance := range instances {
+		s.checkFeed(instance, now)
+	}
+}
+
+// checkFeed flags the instruments of a ticker that have not ticked for the
+// instrument stale time while their exchange is open, and the connection if
+// no instrument ticked for the connection stale time while any exchange is
+// open. Flagged feeds recover once they tick again, and are recovered with
+// the configured action again every stale time until they do
+func (s *TickerService) checkFeed(instance *TickerInstance, now time.Time) {
+	userID, botID := instance.UserID, instance.BotID
+	w := instance.Feed
+
+	w.mu.Lock()
+	connectedAt, lastTick := w.connectedAt, w.lastTick
+	lastTicks := maps.Clone(w.lastTicks)
+	w.mu.Unlock()
+
+	if connectedAt.IsZero() {
+		return
+	}
+
+	var stale, recovered, retry []uint32
+	var firstOpen time.Time
+	for token, instrument := range instance.TokenMap {
+		exchange, _, _ := strings.Cut(instrument, ":")
+		opened, open := s.calendar.OpenSince(exchange, now)
+		if !open {
+			delete(w.stale, token)
+			continue
+		}
+		if firstOpen.IsZero() || opened.Before(firstOpen) {
+			firstOpen = opened
+		}
+
+		last := lastTicks[token]
+		if flagged, ok := w.stale[token]; ok {
+			if last.After(flagged.flaggedAt) {
+				delete(w.stale, token)
+				recovered = append(recovered, token)
+			} else if now.Sub(flagged.recoveredAt) >= s.feedInstrumentStaleAfter {
+				flagged.recoveredAt = now
+				retry = append(retry, token)
+			}
+			continue
+		}
+
+		if now.Sub(latest(last, connectedAt, opened)) >= s.feedInstrumentStaleAfter {
+			w.stale[token] = &staleFeed{flaggedAt: now, recoveredAt: now}
+			stale = append(stale, token)
+		}
+	}
+	instance.Metrics.StaleInstruments.Set(float64(len(w.stale)))
+
+	if len(recovered) > 0 {
+		event := subscriptionEvent(EventFeedRecovered, "", recovered, instance)
+		event.Message = fmt.Sprintf("%d instruments are ticking again", len(recovered))
+		s.logTickerEvent(userID, botID, "INFO", "FeedWatchdog", fmt.Sprintf("%s: %s", event.Message, strings.Join(event.Instruments, ",")))
+		s.publishEvent(userID, botID, event)
+	}
+	if len(stale) > 0 {
+		event := subscriptionEvent(EventFeedStale, "", stale, instance)
+		event.Message = fmt.Sprintf("%d instruments have not ticked for %v", len(stale), s.feedInstrumentStaleAfter)
+		s.logTickerEvent(userID, botID, "WARN", "FeedWatchdog", fmt.Sprintf("%s: %s", event.Message, strings.Join(event.Instruments, ",")))
+		s.publishEvent(userID, botID, event)
+	}
+
+	// The connection is stale when no instrument ticks while any is open
+	connStale := false
+	switch {
+	case firstOpen.IsZero():
+		w.connStale = nil
+	case w.connStale != nil:
+		if lastTick.After(w.connStale.flaggedAt) {
+			w.connStale = nil
+			message := "Instruments are ticking again"
+			s.logTickerEvent(userID, botID, "INFO", "FeedWatchdog", message)
+			s.publishEvent(userID, botID, TickerEvent{Type: EventFeedRecovered, Message: message})
+		} else if now.Sub(w.connStale.recoveredAt) >= s.feedConnectionStaleAfter {
+			w.connStale.recoveredAt = now
+			connStale = true
+		}
+	case now.Sub(latest(lastTick, connectedAt, firstOpen)) >= s.feedConnectionStaleAfter:
+		w.connStale = &staleFeed{flaggedAt: now, recoveredAt: now}
+		connStale = true
+		message := fmt.Sprintf("No instrument has ticked for %v", s.feedConnectionStaleAfter)
+		s.logTickerEvent(userID, botID, "WARN", "FeedWatchdog", message)
+		s.publishEvent(userID, botID, TickerEvent{Type: EventFeedStale, Message: message})
+	}
+
+	// A stale connection is recovered as a whole
+	switch {
+	case connStale:
+		tokens := make([]uint32, 0, len(instance.TokenMap)+len(instance.Underlyings))
+		for token := range instance.TokenMap {
+			tokens = append(tokens, token)
+		}
+		for token := range instance.Underlyings {
+			if _, ok := instance.TokenMap[token]; !ok {
+				tokens = append(tokens, token)
+			}
+		}
+		s.recoverFeed(instance, tokens)
+	case len(stale)+len(retry) > 0:
+		s.recoverFeed(instance, append(stale, retry...))
+	}
+}
+
+// recoverFeed resubscribes the stale tokens of a ticker, or recycles its
+// connection, as configured. The ticker resubscribes all tokens when it
+// reconnects
+func (s *TickerService) recoverFeed(instance *TickerInstance, tokens []uint32) {
+	if s.feedRecovery == FeedRecoveryOff {
+		return
+	}
+
+	userID, botID := instance.UserID, instance.BotID
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.isRunningLocked(userID, botID, instance) {
+		return
+	}
+
+	var err error
+	switch s.feedRecovery {
+	case FeedRecoveryResubscribe:
+		if err = instance.Ticker.Unsubscribe(tokens); err == nil {
+			err = s.subscribe(instance.Ticker, tokens)
+		}
+	case FeedRecoveryReconnect:
+		// Kite answers the close frame by closing the connection, which the
+		// ticker reconnects
+		err = instance.Ticker.Close()
+	}
+	metrics.FeedRecoveries.WithLabelValues(userID, botID, s.feedRecovery).Inc()
+
+	if err != nil {
+		s.logTickerEvent(userID, botID, "ERROR", "FeedWatchdog", fmt.Sprintf("Failed to %s stale feed: %v", s.feedRecovery, err))
+		return
+	}
+	if s.feedRecovery == FeedRecoveryResubscribe {
+		s.logTickerEvent(userID, botID, "INFO", "FeedWatchdog", fmt.Sprintf("Resubscribed %d stale instruments", len(tokens)))
+	} else {
+		s.logTickerEvent(userID, botID, "INFO", "FeedWatchdog", "Recycled the connection of the stale feed")
+	}
+}
+
+// latest returns the latest of times
+func latest(times ...time.Time) time.Time {
+	var t time.Time
+	for _, u := range times {
+		if u.After(t) {
+			t = u
+		}
+	}
+	return t
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nsvirk/moneybotstds/internal/config"
+	"github.com/nsvirk/moneybotstds/internal/repository"
+	"gorm.io/gorm"
+)
+
+// Service phases, the service is ready only in PhaseReady
+const (
+	PhaseStarting = "starting" // resuming the tickers of the last run
+	PhaseReady    = "ready"
+	PhaseDraining = "draining" // shutting down
+)
+
+// Component statuses. A failed component makes the service not ready, a
+// warning does not
+const (
+	StatusOK   = "ok"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+)
+
+// How long a dependency check may take
+const healthCheckTimeout = 2 * time.Second
+
+// ComponentHealth is the status of one dependency of the service
+type ComponentHealth struct {
+	Status    string `json:"status"`
+	Message   string `json:"message,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+// Readiness is the result of the readiness checks
+type Readiness struct {
+	Ready      bool                       `json:"ready"`
+	Phase      string                     `json:"phase"`
+	Components map[string]ComponentHealth `json:"components"`
+}
+
+// HealthService tracks the phase of the service and checks its dependencies
+type HealthService struct {
+	db                *gorm.DB
+	redisClient       *repository.RedisClient
+	instrumentService *InstrumentService
+	tickerService     *TickerService
+	instrumentsMaxAge time.Duration
+	startedAt         time.Time
+
+	mu    sync.RWMutex
+	phase string
+}
+
+// NewHealthService creates a new HealthService in PhaseStarting
+func NewHealthService(cfg *config.Config, db *gorm.DB, redisClient *repository.RedisClient, instrumentService *InstrumentService, tickerService *TickerService) *HealthService {
+	return &HealthService{
+		db:                db,
+		redisClient:       redisClient,
+		instrumentService: instrumentService,
+		tickerService:     tickerService,
+		instrumentsMaxAge: cfg.InstrumentsMaxAge,
+		startedAt:         time.Now(),
+		phase:             PhaseStarting,
+	}
+}
+
+// SetPhase sets the phase of the service. A draining service stays draining
+func (s *HealthService) SetPhase(phase string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.phase != PhaseDraining {
+		s.phase = phase
+	}
+}
+
+// Phase returns the phase of the service
+func (s *HealthService) Phase() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.phase
+}
+
+// Uptime returns the time since the service started
+func (s *HealthService) Uptime() time.Duration {
+	return time.Since(s.startedAt)
+}
+
+// Readiness checks the dependencies of the service concurrently. The service
+// is ready if it is in PhaseReady and no component failed
+func (s *HealthService) Readiness(ctx context.Context) Readiness {
+	checks := map[string]func(context.Context) ComponentHealth{
+		"database":    s.checkDatabase,
+		"redis":       s.checkRedis,
+		"instruments": s.checkInstruments,
+		"tickers":     s.checkTickers,
+	}
+
+	readiness := Readiness{
+		Phase:      s.Phase(),
+		Components: make(map[string]ComponentHealth, len(checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(context.Context) ComponentHealth) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			health := check(ctx)
+			health.LatencyMs = time.Since(start).Milliseconds()
+
+			mu.Lock()
+			readiness.Components[name] = health
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	readiness.Ready = readiness.Phase == PhaseReady
+	for _, health := range readiness.Components {
+		if health.Status == StatusFail {
+			readiness.Ready = false
+		}
+	}
+
+	return readiness
+}
+
+func (s *HealthService) checkDatabase(ctx context.Context) ComponentHealth {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return ComponentHealth{Status: StatusFail, Message: err.Error()}
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return ComponentHealth{Status: StatusFail, Message: err.Error()}
+	}
+	return ComponentHealth{Status: StatusOK}
+}
+
+func (s *HealthService) checkRedis(ctx context.Context) ComponentHealth {
+	if err := s.redisClient.Ping(ctx); err != nil {
+		return ComponentHealth{Status: StatusFail, Message: err.Error()}
+	}
+	return ComponentHealth{Status: StatusOK}
+}
+
+// checkInstruments fails if no instruments are cached, since tickers cannot
+// resolve instruments, and warns if the last load is older than the max age
+func (s *HealthService) checkInstruments(ctx context.Context) ComponentHealth {
+	stats := s.instrumentService.CacheStats()
+	if stats.Instruments == 0 {
+		return ComponentHealth{Status: StatusFail, Message: "no instruments loaded"}
+	}
+
+	refreshedAt, err := s.instrumentService.LastRefreshedAt()
+	if err != nil {
+		return ComponentHealth{Status: StatusWarn, Message: fmt.Sprintf("failed to get last refresh: %v", err)}
+	}
+	if refreshedAt.IsZero() {
+		return ComponentHealth{Status: StatusWarn, Message: "instruments were never refreshed"}
+	}
+	if age := time.Since(refreshedAt); age > s.instrumentsMaxAge {
+		return ComponentHealth{Status: StatusWarn, Message: fmt.Sprintf("instruments refreshed %s ago", age.Round(time.Minute))}
+	}
+
+	return ComponentHealth{Status: StatusOK, Message: fmt.Sprintf("%d instruments, refreshed at %s", stats.Instruments, refreshedAt.Format(time.RFC3339))}
+}
+
+func (s *HealthService) checkTickers(ctx context.Context) ComponentHealth {
+	if err := ctx.Err(); err != nil {
+		return ComponentHealth{Status: StatusFail, Message: err.Error()}
+	}
+	running := s.tickerService.RunningCount()
+
+	switch s.Phase() {
+	case PhaseStarting:
+		return ComponentHealth{Status: StatusWarn, Message: fmt.Sprintf("resuming tickers, %d running", running)}
+	case PhaseDraining:
+		return ComponentHealth{Status: StatusWarn, Message: fmt.Sprintf("draining, %d running", running)}
+	}
+	return ComponentHealth{Status: StatusOK, Message: fmt.Sprintf("%d running", running)}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nsvirk/moneybotstds/internal/models"
+	"github.com/nsvirk/moneybotstds/internal/repository"
+	"gorm.io/gorm"
+)
+
+// InstrumentCache is an in-memory copy of the instruments table, used to
+// resolve symbols and tokens without a database round-trip per instrument.
+// Lookups that miss the cache fall back to the database
+type InstrumentCache struct {
+	repo *repository.Repository
+
+	mu           sync.RWMutex
+	bySymbol     map[string]*models.Instrument
+	byToken      map[uint32]*models.Instrument
+	futures      map[string][]*models.Instrument // by exchange:name, sorted by expiry
+	sorted       []*models.Instrument            // sorted by tradingsymbol
+	loadedAt     time.Time
+	loadDuration time.Duration
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// InstrumentCacheStats are the statistics of the instrument cache
+type InstrumentCacheStats struct {
+	Instruments  int
+	LoadedAt     time.Time
+	LoadDuration time.Duration
+	Hits         uint64
+	Misses       uint64
+}
+
+// NewInstrumentCache creates a new empty InstrumentCache
+func NewInstrumentCache(db *gorm.DB) *InstrumentCache {
+	return &InstrumentCache{
+		repo:     repository.NewRepository(db),
+		bySymbol: make(map[string]*models.Instrument),
+		byToken:  make(map[uint32]*models.Instrument),
+		futures:  make(map[string][]*models.Instrument),
+	}
+}
+
+// Load replaces the cache contents with the instruments table
+func (c *InstrumentCache) Load() error {
+	start := time.Now()
+
+	instruments, err := c.repo.GetInstruments()
+	if err != nil {
+		return fmt.Errorf("failed to load instruments: %w", err)
+	}
+
+	bySymbol := make(map[string]*models.Instrument, len(instruments))
+	byToken := make(map[uint32]*models.Instrument, len(instruments))
+	futures := make(map[string][]*models.Instrument)
+	sorted := make([]*models.Instrument, 0, len(instruments))
+
+	for i := range instruments {
+		instrument := &instruments[i]
+		bySymbol[instrument.Exchange+":"+instrument.Tradingsymbol] = instrument
+		byToken[instrument.InstrumentToken] = instrument
+		sorted = append(sorted, instrument)
+
+		if instrument.InstrumentType == "FUT" && instrument.Expiry != nil {
+			key := instrument.Exchange + ":" + instrument.Name
+			futures[key] = append(futures[key], instrument)
+		}
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Tradingsymbol < sorted[j].Tradingsymbol
+	})
+	for _, list := range futures {
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].Expiry.Before(*list[j].Expiry)
+		})
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.bySymbol = bySymbol
+	c.byToken = byToken
+	c.futures = futures
+	c.sorted = sorted
+	c.loadedAt = time.Now()
+	c.loadDuration = time.Since(start)
+
+	return nil
+}
+
+// Lookup returns the instrument for an exchange and tradingsymbol
+func (c *InstrumentCache) Lookup(exchange, tradingsymbol string) (*models.Instrument, error) {
+	c.mu.RLock()
+	instrument, ok := c.bySymbol[exchange+":"+tradingsymbol]
+	c.mu.RUnlock()
+
+	if ok {
+		c.hits.Add(1)
+		return instrument, nil
+	}
+
+	c.misses.Add(1)
+	return c.repo.GetInstrument(exchange, tradingsymbol)
+}
+
+// LookupToken returns the instrument for an instrument token
+func (c *InstrumentCache) LookupToken(token uint32) (*models.Instrument, error) {
+	c.mu.RLock()
+	instrument, ok := c.byToken[token]
+	c.mu.RUnlock()
+
+	if ok {
+		c.hits.Add(1)
+		return instrument, nil
+	}
+
+	c.misses.Add(1)
+	return c.repo.GetInstrumentByToken(token)
+}
+
+// UnderlyingFuture returns the nearest future of name on exchange expiring on
+// or after expiry
+func (c *InstrumentCache) UnderlyingFuture(exchange, name string, expiry time.Time) (*models.Instrument, error) {
+	c.mu.RLock()
+	list := c.futures[exchange+":"+name]
+	c.mu.RUnlock()
+
+	for _, instrument := range list {
+		if !instrument.Expiry.Before(expiry) {
+			c.hits.Add(1)
+			return instrument, nil
+		}
+	}
+
+	c.misses.Add(1)
+	return c.repo.GetUnderlyingFuture(exchange, name, expiry)
+}
+
+// Select returns up to limit instruments matching match, in tradingsymbol order.
+// A limit of 0 returns all matches
+func (c *InstrumentCache) Select(match func(*models.Instrument) bool, limit int) []models.Instrument {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var results []models.Instrument
+	for _, instrument := range c.sorted {
+		if limit > 0 && len(results) >= limit {
+			break
+		}
+		if match(instrument) {
+			results = append(results, *instrument)
+		}
+	}
+	return results
+}
+
+// Stats returns the cache statistics
+func (c *InstrumentCache) Stats() InstrumentCacheStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return InstrumentCacheStats{
+		Instruments:  len(c.sorted),
+		LoadedAt:     c.loadedAt,
+		LoadDuration: c.loadDuration,
+		Hits:         c.hits.Load(),
+		Misses:       c.misses.Load(),
+	}
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/nsvirk/moneybotstds/internal/models"
+)
+
+// Instrument metadata modes
+const (
+	// MetadataEmbed embeds the metadata in every published tick
+	MetadataEmbed = "embed"
+	// MetadataChannel publishes the metadata once on the metadata channel and
+	// stores it under the metadata key
+	MetadataChannel = "channel"
+)
+
+// InstrumentMetadata is the static data of a subscribed instrument
+type InstrumentMetadata struct {
+	InstrumentToken uint32
+	Exchange        string
+	TradingSymbol   string
+	Name            string
+	Segment         string
+	InstrumentType  string
+	Expiry          string `json:",omitempty"`
+	Strike          float64
+	LotSize         int
+	TickSize        float64
+}
+
+// loadInstrumentMetadata looks up the metadata of every instrument in tickerInstruments
+func (s *TickerService) loadInstrumentMetadata(tickerInstruments []models.TickerInstrument) (map[uint32]*InstrumentMetadata, error) {
+	metadata := make(map[uint32]*InstrumentMetadata, len(tickerInstruments))
+
+	for _, inst := range tickerInstruments {
+		instrument, err := s.instrumentCache.LookupToken(inst.InstrumentToken)
+		if err != nil {
+			return nil, err
+		}
+
+		meta := &InstrumentMetadata{
+			InstrumentToken: instrument.InstrumentToken,
+			Exchange:        instrument.Exchange,
+			TradingSymbol:   instrument.Tradingsymbol,
+			Name:            instrument.Name,
+			Segment:         instrument.Segment,
+			InstrumentType:  instrument.InstrumentType,
+			Strike:          instrument.Strike,
+			LotSize:         instrument.LotSize,
+			TickSize:        instrument.TickSize,
+		}
+		if instrument.Expiry != nil {
+			meta.Expiry = instrument.Expiry.Format("2006-01-02")
+		}
+
+		metadata[inst.InstrumentToken] = meta
+	}
+
+	return metadata, nil
+}
+
+// publishInstrumentMetadata stores the metadata of all instruments under the
+// metadata key and publishes it on the metadata channel, as a JSON array
+// sorted by exchange and tradingsymbol
+func (s *TickerService) publishInstrumentMetadata(ctx context.Context, userID, botID string, metadata map[uint32]*InstrumentMetadata) error {
+	list := make([]*InstrumentMetadata, 0, len(metadata))
+	for _, meta := range metadata {
+		list = append(list, meta)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Exchange != list[j].Exchange {
+			return list[i].Exchange < list[j].Exchange
+		}
+		return list[i].TradingSymbol < list[j].TradingSymbol
+	})
+
+	metadataJSON, err := json.Marshal(list)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	if err := s.redisClient.Set(ctx, s.GetMetadataKey(userID, botID), metadataJSON); err != nil {
+		return err
+	}
+
+	return s.redisClient.Publish(ctx, s.GetMetadataChannel(userID, botID), metadataJSON)
+}
+
+// GetMetadataChannel returns the channel instrument metadata is published on
+func (s *TickerService) GetMetadataChannel(userID, botID string) string {
+	return fmt.Sprintf("CH:META:%s:%s", userID, botID)
+}
+
+// GetMetadataKey returns the key instrument metadata is stored under
+func (s *TickerService) GetMetadataKey(userID, botID string) string {
+	return fmt.Sprintf("META:%s:%s", userID, botID)
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nsvirk/moneybotstds/internal/models"
+)
+
+const (
+	// Number of instruments returned by a search
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// InstrumentQuery is an instrument search, all fields except Q are exact filters
+type InstrumentQuery struct {
+	Q        string
+	Exchange string
+	Segment  string
+	Expiry   *time.Time
+	Limit    int
+}
+
+// Search returns instruments whose tradingsymbol or name matches q. Prefix
+// matches come first, then substring matches. If neither matches, it falls back
+// to tradingsymbols within a small edit distance of q to catch typos
+func (s *InstrumentService) Search(query InstrumentQuery) []models.Instrument {
+	q := strings.ToUpper(strings.TrimSpace(query.Q))
+	exchange := strings.ToUpper(query.Exchange)
+	segment := strings.ToUpper(query.Segment)
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	// filtered applies the exact filters before a match
+	filtered := func(match func(*models.Instrument) bool) func(*models.Instrument) bool {
+		return func(instrument *models.Instrument) bool {
+			if exchange != "" && instrument.Exchange != exchange {
+				return false
+			}
+			if segment != "" && instrument.Segment != segment {
+				return false
+			}
+			if query.Expiry != nil && (instrument.Expiry == nil || !instrument.Expiry.Equal(*query.Expiry)) {
+				return false
+			}
+			return match(instrument)
+		}
+	}
+
+	// Prefix matches
+	results := s.cache.Select(filtered(func(instrument *models.Instrument) bool {
+		return strings.HasPrefix(instrument.Tradingsymbol, q) || strings.HasPrefix(instrument.Name, q)
+	}), limit)
+	if len(results) >= limit || q == "" {
+		return results
+	}
+
+	// Substring matches
+	seen := make(map[uint32]bool, len(results))
+	for _, instrument := range results {
+		seen[instrument.InstrumentToken] = true
+	}
+	contains := s.cache.Select(filtered(func(instrument *models.Instrument) bool {
+		return !seen[instrument.InstrumentToken] &&
+			(strings.Contains(instrument.Tradingsymbol, q) || strings.Contains(instrument.Name, q))
+	}), limit-len(results))
+	results = append(results, contains...)
+	if len(results) > 0 || len(q) < 3 {
+		return results
+	}
+
+	// Fuzzy matches among tradingsymbols sharing the first two characters
+	candidates := s.cache.Select(filtered(func(instrument *models.Instrument) bool {
+		return strings.HasPrefix(instrument.Tradingsymbol, q[:2])
+	}), 0)
+
+	return fuzzyMatch(q, candidates, limit)
+}
+
+// Lookup returns the instrument for an exchange and tradingsymbol
+func (s *InstrumentService) Lookup(exchange, tradingsymbol string) (*models.Instrument, error) {
+	return s.cache.Lookup(strings.ToUpper(exchange), strings.ToUpper(tradingsymbol))
+}
+
+// fuzzyMatch returns the candidates whose tradingsymbol is within a small edit
+// distance of q, closest first
+func fuzzyMatch(q string, candidates []models.Instrument, limit int) []models.Instrument {
+	maxDistance := len(q) / 5
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+
+	type match struct {
+		instrument models.Instrument
+		distance   int
+	}
+	var matches []match
+	for _, instrument := range candidates {
+		if d := levenshtein(q, instrument.Tradingsymbol); d <= maxDistance {
+			matches = append(matches, match{instrument: instrument, distance: d})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].distance < matches[j].distance
+	})
+
+	results := make([]models.Instrument, 0, limit)
+	for _, m := range matches {
+		if len(results) >= limit {
+			break
+		}
+		results = append(results, m.instrument)
+	}
+	return results
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nsvirk/moneybotstds/internal/logger"
+	"github.com/nsvirk/moneybotstds/internal/market"
+	"github.com/nsvirk/moneybotstds/internal/models"
+	"github.com/nsvirk/moneybotstds/internal/repository"
+	"gorm.io/gorm"
+)
+
+// InstrumentService loads the Kite instruments dump into the instruments table
+type InstrumentService struct {
+	repo      *repository.Repository
+	cache     *InstrumentCache
+	source    string
+	client    *http.Client
+	appLogger *logger.AppLogger
+}
+
+// NewInstrumentService creates a new InstrumentService reading from source,
+// which is either a file path or an http(s) URL, and reloading cache after
+// every refresh. cache may be nil when no cache needs to be kept in sync
+func NewInstrumentService(db *gorm.DB, source string, cache *InstrumentCache) *InstrumentService {
+	return &InstrumentService{
+		repo:      repository.NewRepository(db),
+		cache:     cache,
+		source:    source,
+		client:    &http.Client{Timeout: 2 * time.Minute},
+		appLogger: logger.NewAppLogger(db),
+	}
+}
+
+// Refresh loads the instruments dump, upserts every instrument, prunes expired
+// instruments, records the load and reloads the cache
+func (s *InstrumentService) Refresh() (*models.InstrumentLoad, error) {
+	rc, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	instruments, err := parseInstrumentsCSV(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse instruments: %w", err)
+	}
+	if len(instruments) == 0 {
+		return nil, fmt.Errorf("no instruments found in %s", s.source)
+	}
+
+	now := time.Now()
+	if err := s.repo.UpsertInstruments(instruments); err != nil {
+		return nil, fmt.Errorf("failed to upsert instruments: %w", err)
+	}
+
+	// Prune instruments that expired before today
+	y, m, d := now.In(market.IST).Date()
+	pruned, err := s.repo.DeleteExpiredInstruments(time.Date(y, m, d, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune expired instruments: %w", err)
+	}
+
+	load := &models.InstrumentLoad{
+		Source:        s.source,
+		InstrumentsCt: len(instruments),
+		PrunedCt:      int(pruned),
+		LoadedAt:      now,
+	}
+	if err := s.repo.InsertInstrumentLoad(load); err != nil {
+		return nil, fmt.Errorf("failed to record instruments load: %w", err)
+	}
+
+	if s.cache != nil {
+		if err := s.cache.Load(); err != nil {
+			return nil, err
+		}
+	}
+
+	return load, nil
+}
+
+// LastRefreshedAt returns the time of the last successful refresh, or the zero
+// time if the instruments were never loaded
+func (s *InstrumentService) LastRefreshedAt() (time.Time, error) {
+	load, err := s.repo.GetLastInstrumentLoad()
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return load.LoadedAt, nil
+}
+
+// ReloadCache reloads the instrument cache from the instruments table
+func (s *InstrumentService) ReloadCache() error {
+	return s.cache.Load()
+}
+
+// CacheStats returns the instrument cache statistics
+func (s *InstrumentService) CacheStats() InstrumentCacheStats {
+	return s.cache.Stats()
+}
+
+// RunRefreshJob refreshes the instruments every day at refreshAt (HH:MM, IST)
+// until ctx is cancelled. If the last refresh missed the most recent scheduled
+// run, it refreshes immediately
+func (s *InstrumentService) RunRefreshJob(ctx context.Context, refreshAt string) {
+	at, err := time.Parse("15:04", refreshAt)
+	if err != nil {
+		s.appLogger.Error("Invalid instruments refresh time", "refresh_at", refreshAt, "error", err)
+		return
+	}
+
+	next := nextDailyRun(time.Now(), at.Hour(), at.Minute())
+	if last, err := s.LastRefreshedAt(); err == nil && last.Before(next.AddDate(0, 0, -1)) {
+		s.refreshAndLog()
+	}
+
+	for {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.refreshAndLog()
+		}
+		next = nextDailyRun(time.Now(), at.Hour(), at.Minute())
+	}
+}
+
+func (s *InstrumentService) refreshAndLog() {
+	load, err := s.Refresh()
+	if err != nil {
+		s.appLogger.Error("Failed to refresh instruments", "error", err)
+		return
+	}
+	s.appLogger.Info("Instruments refreshed", "loaded", load.InstrumentsCt, "pruned", load.PrunedCt)
+}
+
+// open returns a reader over the instruments dump
+func (s *InstrumentService) open() (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	if strings.HasPrefix(s.source, "http://") || strings.HasPrefix(s.source, "https://") {
+		resp, err := s.client.Get(s.source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download instruments: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to download instruments: status %d", resp.StatusCode)
+		}
+		rc = resp.Body
+	} else {
+		f, err := os.Open(s.source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open instruments file: %w", err)
+		}
+		rc = f
+	}
+
+	if !strings.HasSuffix(s.source, ".gz") {
+		return rc, nil
+	}
+
+	gz, err := gzip.NewReader(rc)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("failed to read gzip instruments: %w", err)
+	}
+	return &gzipReadCloser{Reader: gz, rc: rc}, nil
+}
+
+// gzipReadCloser closes both the gzip reader and the underlying reader
+type gzipReadCloser struct {
+	*gzip.Reader
+	rc io.Closer
+}
+
+func (g *gzipReadCloser) Close() error {
+	g.Reader.Close()
+	return g.rc.Close()
+}
+
+// parseInstrumentsCSV parses the Kite instruments CSV, locating columns by header
+func parseInstrumentsCSV(r io.Reader) ([]models.Instrument, error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		cols[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"instrument_token", "exchange_token", "tradingsymbol", "name", "last_price", "expiry", "strike", "tick_size", "lot_size", "instrument_type", "segment", "exchange"} {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("missing column: %s", name)
+		}
+	}
+
+	var instruments []models.Instrument
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		instrument, err := parseInstrumentRecord(record, cols)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		instruments = append(instruments, instrument)
+	}
+
+	return instruments, nil
+}
+
+func parseInstrumentRecord(record []string, cols map[string]int) (models.Instrument, error) {
+	field := func(name string) string {
+		return strings.TrimSpace(record[cols[name]])
+	}
+
+	instrumentToken, err := strconv.ParseUint(field("instrument_token"), 10, 32)
+	if err != nil {
+		return models.Instrument{}, fmt.Errorf("invalid instrument_token: %w", err)
+	}
+	exchangeToken, err := strconv.ParseUint(field("exchange_token"), 10, 32)
+	if err != nil {
+		return models.Instrument{}, fmt.Errorf("invalid exchange_token: %w", err)
+	}
+	lastPrice, err := parseFloatField(field("last_price"))
+	if err != nil {
+		return models.Instrument{}, fmt.Errorf("invalid last_price: %w", err)
+	}
+	strike, err := parseFloatField(field("strike"))
+	if err != nil {
+		return models.Instrument{}, fmt.Errorf("invalid strike: %w", err)
+	}
+	tickSize, err := parseFloatField(field("tick_size"))
+	if err != nil {
+		return models.Instrument{}, fmt.Errorf("invalid tick_size: %w", err)
+	}
+	lotSize, err := strconv.Atoi(field("lot_size"))
+	if err != nil {
+		return models.Instrument{}, fmt.Errorf("invalid lot_size: %w", err)
+	}
+
+	instrument := models.Instrument{
+		InstrumentToken: uint32(instrumentToken),
+		ExchangeToken:   uint32(exchangeToken),
+		Tradingsymbol:   field("tradingsymbol"),
+		Name:            field("name"),
+		LastPrice:       lastPrice,
+		Strike:          strike,
+		TickSize:        tickSize,
+		LotSize:         lotSize,
+		InstrumentType:  field("instrument_type"),
+		Segment:         field("segment"),
+		Exchange:        field("exchange"),
+	}
+
+	if expiry := field("expiry"); expiry != "" {
+		t, err := time.Parse("2006-01-02", expiry)
+		if err != nil {
+			return models.Instrument{}, fmt.Errorf("invalid expiry: %w", err)
+		}
+		instrument.Expiry = &t
+	}
+
+	return instrument, nil
+}
+
+func parseFloatField(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// nextDailyRun returns the next time after now that is hour:min in IST
+func nextDailyRun(now time.Time, hour, min int) time.Time {
+	ist := now.In(market.IST)
+	next := time.Date(ist.Year(), ist.Month(), ist.Day(), hour, min, 0, 0, market.IST)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"time"
+
+	"github.com/nsvirk/moneybotstds/internal/models"
+	"github.com/nsvirk/moneybotstds/internal/repository"
+	"gorm.io/gorm"
+)
+
+// Number of log rows returned by a log query
+const (
+	DefaultLogLimit = 100
+	MaxLogLimit     = 1000
+)
+
+// LogService reads the ticker_logs and logs tables
+type LogService struct {
+	repo *repository.Repository
+}
+
+// NewLogService creates a new LogService
+func NewLogService(db *gorm.DB) *LogService {
+	return &LogService{repo: repository.NewRepository(db)}
+}
+
+// TickerLogQuery filters the ticker logs, zero fields are not filtered on
+type TickerLogQuery struct {
+	Filter   models.TickerLog // user, bot, level and event type
+	Since    time.Time
+	Until    time.Time
+	BeforeID uint32 // return logs older than this id, to fetch the next page
+	Limit    int
+}
+
+// QueryTickerLogs returns a page of the ticker logs matching a query, newest
+// first. If the page is full the id to fetch the next page before is returned
+func (s *LogService) QueryTickerLogs(query TickerLogQuery) ([]models.TickerLog, uint32, error) {
+	limit := clampLogLimit(query.Limit)
+	tickerLogs, err := s.repo.GetTickerLogs(query.Filter, query.Since, query.Until, query.BeforeID, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var nextBeforeID uint32
+	if len(tickerLogs) == limit {
+		nextBeforeID = tickerLogs[len(tickerLogs)-1].ID
+	}
+	return tickerLogs, nextBeforeID, nil
+}
+
+// TickerLogsAfter returns the ticker logs matching filter newer than afterID,
+// oldest first, to tail the logs
+func (s *LogService) TickerLogsAfter(filter models.TickerLog, afterID uint32) ([]models.TickerLog, error) {
+	return s.repo.GetTickerLogsAfter(filter, afterID, MaxLogLimit)
+}
+
+// LastTickerLogID returns the id of the latest ticker log, tails start after it
+func (s *LogService) LastTickerLogID() (uint32, error) {
+	return s.repo.GetLastTickerLogID()
+}
+
+// RecentLogs returns the latest app logs with a level if set, newest first
+func (s *LogService) RecentLogs(level string, limit int) ([]models.Log, error) {
+	return s.repo.GetLogs(level, clampLogLimit(limit))
+}
+
+func clampLogLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultLogLimit
+	}
+	return min(limit, MaxLogLimit)
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/nsvirk/moneybotstds/internal/market"
+)
+
+// marketClockMaxWait bounds the wait for the next session boundary, so
+// holidays reloaded meanwhile are followed
+const marketClockMaxWait = time.Minute
+
+// marketEventTypes are the ticker events of the session boundaries
+var marketEventTypes = map[string]string{
+	market.BoundaryPreOpen:    EventPreOpen,
+	market.BoundaryOpen:       EventMarketOpen,
+	market.BoundaryClose:      EventMarketClose,
+	market.BoundarySettlement: EventSettlement,
+}
+
+// RunMarketClock publishes the session boundaries of the exchanges on the
+// events channels of the running tickers with instruments of the exchange,
+// until ctx is cancelled
+func (s *TickerService) RunMarketClock(ctx context.Context) {
+	last := time.Now()
+	for {
+		wait := marketClockMaxWait
+		if next, ok := s.nextBoundary(last); ok {
+			wait = min(wait, time.Until(next))
+		}
+
+		timer := time.NewTimer(max(wait, 0))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		now := time.Now()
+		s.publishBoundaries(last, now)
+		last = now
+	}
+}
+
+// nextBoundary returns the first session boundary of any exchange after t
+// and within marketClockMaxWait
+func (s *TickerService) nextBoundary(t time.Time) (time.Time, bool) {
+	var next time.Time
+	for _, exchange := range market.Exchanges() {
+		boundaries := s.calendar.Boundaries(exchange, t, t.Add(marketClockMaxWait))
+		if len(boundaries) > 0 && (next.IsZero() || boundaries[0].At.Before(next)) {
+			next = boundaries[0].At
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// publishBoundaries publishes the session boundaries after from up to to
+func (s *TickerService) publishBoundaries(from, to time.Time) {
+	var boundaries []market.Boundary
+	for _, exchange := range market.Exchanges() {
+		boundaries = append(boundaries, s.calendar.Boundaries(exchange, from, to)...)
+	}
+	if len(boundaries) == 0 {
+		return
+	}
+	sort.SliceStable(boundaries, func(i, j int) bool { return boundaries[i].At.Before(boundaries[j].At) })
+
+	s.mu.Lock()
+	instances := make([]*TickerInstance, 0, len(s.tickers))
+	for _, instance := range s.tickers {
+		instances = append(instances, instance)
+	}
+	s.mu.Unlock()
+
+	for _, boundary := range boundaries {
+		event := TickerEvent{
+			Type:     marketEventTypes[boundary.Kind],
+			Message:  boundaryMessage(boundary),
+			Exchange: boundary.Exchange,
+			Session:  boundary.Session,
+		}
+		for _, instance := range instances {
+			if !slices.Contains(instance.Exchanges, boundary.Exchange) {
+				continue
+			}
+			s.logTickerEvent(instance.UserID, instance.BotID, "INFO", "MarketClock", event.Message)
+			s.publishEvent(instance.UserID, instance.BotID, event)
+		}
+	}
+}
+
+func boundaryMessage(boundary market.Boundary) string {
+	switch boundary.Kind {
+	case market.BoundaryPreOpen:
+		return fmt.Sprintf("%s pre-open started", boundary.Exchange)
+	case market.BoundaryOpen:
+		return fmt.Sprintf("%s %s session opened", boundary.Exchange, boundary.Session)
+	case market.BoundaryClose:
+		return fmt.Sprintf("%s %s session closed", boundary.Exchange, boundary.Session)
+	default:
+		return fmt.Sprintf("%s trading day ended, closing prices are final", boundary.Exchange)
+	}
+}
+
+// sessionPhase returns the phase of an exchange a tick at t belongs to, ticks
+// without an exchange timestamp by their receive time. Phases are cached by
+// exchange until they end
+func (s *TickerService) sessionPhase(instance *TickerInstance, exchange string, t time.Time) string {
+	if !market.Known(exchange) {
+		return ""
+	}
+	if t.IsZero() {
+		t = instance.receivedAt
+	}
+
+	phase, ok := instance.phases[exchange]
+	if !ok || t.Before(phase.Start) || !t.Before(phase.End) {
+		phase = s.calendar.PhaseAt(exchange, t)
+		instance.phases[exchange] = phase
+	}
+	return phase.Name
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	kitemodels "github.com/nsvirk/gokiteticker/models"
+	"github.com/nsvirk/moneybotstds/internal/greeks"
+	"github.com/nsvirk/moneybotstds/internal/market"
+	"github.com/nsvirk/moneybotstds/internal/models"
+	"gorm.io/gorm"
+)
+
+// optionExchanges are the exchanges whose options are enriched with greeks
+var optionExchanges = map[string]bool{
+	"NFO": true,
+	"BFO": true,
+	"MCX": true,
+}
+
+// optionContract holds the static data needed to price an option
+type optionContract struct {
+	IsCall          bool
+	Strike          float64
+	ExpiresAt       time.Time
+	UnderlyingToken uint32
+}
+
+// loadOptionContracts looks up the strike, expiry and underlying future of every
+// option in tickerInstruments. It returns the contracts keyed by option token and
+// the underlying futures keyed by token
+func (s *TickerService) loadOptionContracts(userID, botID string, tickerInstruments []models.TickerInstrument) (map[uint32]*optionContract, map[uint32]string, error) {
+	contracts := make(map[uint32]*optionContract)
+	underlyings := make(map[uint32]string)
+
+	for _, inst := range tickerInstruments {
+		if !optionExchanges[inst.Exchange] {
+			continue
+		}
+
+		instrument, err := s.instrumentCache.Lookup(inst.Exchange, inst.Tradingsymbol)
+		if err != nil {
+			return nil, nil, err
+		}
+		if (instrument.InstrumentType != "CE" && instrument.InstrumentType != "PE") || instrument.Expiry == nil {
+			continue
+		}
+
+		// Options without an underlying future are published without greeks
+		underlying, err := s.instrumentCache.UnderlyingFuture(instrument.Exchange, instrument.Name, *instrument.Expiry)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logTickerEvent(userID, botID, "WARN", "StartTicker", fmt.Sprintf("No underlying future for %s:%s, publishing it without greeks", inst.Exchange, inst.Tradingsymbol))
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		contracts[inst.InstrumentToken] = &optionContract{
+			IsCall:          instrument.InstrumentType == "CE",
+			Strike:          instrument.Strike,
+			ExpiresAt:       expiryTime(instrument.Exchange, *instrument.Expiry),
+			UnderlyingToken: underlying.InstrumentToken,
+		}
+		underlyings[underlying.InstrumentToken] = fmt.Sprintf("%s:%s", underlying.Exchange, underlying.Tradingsymbol)
+	}
+
+	return contracts, underlyings, nil
+}
+
+// computeGreeks returns the greeks for an option tick, or nil if the tick is not
+// an enriched option or the underlying price is not known yet
+func (s *TickerService) computeGreeks(instance *TickerInstance, tick kitemodels.Tick) *greeks.Greeks {
+	contract, ok := instance.Options[tick.InstrumentToken]
+	if !ok {
+		return nil
+	}
+
+	underlyingPrice, ok := instance.LastPrices[contract.UnderlyingToken]
+	if !ok {
+		return nil
+	}
+
+	t := greeks.YearsToExpiry(time.Until(contract.ExpiresAt))
+	g, ok := greeks.Compute(contract.IsCall, tick.LastPrice, underlyingPrice, contract.Strike, t, s.riskFreeRate)
+	if !ok {
+		return nil
+	}
+
+	return &g
+}
+
+// expiryTime returns the time an option stops trading on its expiry date
+func expiryTime(exchange string, expiry time.Time) time.Time {
+	hour, min := 15, 30
+	if exchange == "MCX" {
+		hour, min = 23, 30
+	}
+	return time.Date(expiry.Year(), expiry.Month(), expiry.Day(), hour, min, 0, 0, market.IST)
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nsvirk/moneybotstds/internal/config"
+	"github.com/nsvirk/moneybotstds/internal/models"
+	"github.com/nsvirk/moneybotstds/internal/repository"
+	"gorm.io/gorm"
+)
+
+// ErrQuotaExceeded is returned when a request exceeds a quota of the user
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// The window start and stop calls are counted in
+const quotaCallWindow = time.Minute
+
+// How long the quota of a user is cached, limits set with SetQuota on another
+// instance apply after it
+const quotaCacheTTL = 30 * time.Second
+
+// Quota is the effective limits of a user, 0 is unlimited
+type Quota struct {
+	MaxBots              int
+	MaxInstrumentsPerBot int
+	MaxInstruments       int
+	MaxCallsPerMinute    int
+}
+
+// QuotaService resolves the quotas of users and limits the rate of their
+// start and stop calls
+type QuotaService struct {
+	repo     *repository.Repository
+	defaults Quota
+
+	mu        sync.Mutex
+	calls     map[string][]time.Time // call times within the window, by user
+	quotas    map[string]cachedQuota
+	lastSweep time.Time
+}
+
+type cachedQuota struct {
+	quota     Quota
+	expiresAt time.Time
+}
+
+// NewQuotaService creates a new QuotaService with the configured defaults
+func NewQuotaService(cfg *config.Config, db *gorm.DB) *QuotaService {
+	return &QuotaService{
+		repo: repository.NewRepository(db),
+		defaults: Quota{
+			MaxBots:              cfg.QuotaMaxBots,
+			MaxInstrumentsPerBot: cfg.QuotaMaxInstrumentsPerBot,
+			MaxInstruments:       cfg.QuotaMaxInstruments,
+			MaxCallsPerMinute:    cfg.QuotaMaxCallsPerMinute,
+		},
+		calls:  make(map[string][]time.Time),
+		quotas: make(map[string]cachedQuota),
+	}
+}
+
+// GetQuota returns the quota of a user, the defaults overridden by the limits
+// stored for the user. Quotas are cached for quotaCacheTTL
+func (s *QuotaService) GetQuota(userID string) (Quota, error) {
+	s.mu.Lock()
+	cached, ok := s.quotas[userID]
+	s.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.quota, nil
+	}
+
+	quota, err := s.loadQuota(userID)
+	if err != nil {
+		return quota, err
+	}
+
+	s.mu.Lock()
+	s.quotas[userID] = cachedQuota{quota: quota, expiresAt: time.Now().Add(quotaCacheTTL)}
+	s.mu.Unlock()
+	return quota, nil
+}
+
+// loadQuota loads the quota of a user from the quotas table
+func (s *QuotaService) loadQuota(userID string) (Quota, error) {
+	quota := s.defaults
+
+	stored, err := s.repo.GetQuota(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return quota, nil
+	}
+	if err != nil {
+		return quota, fmt.Errorf("failed to get quota: %w", err)
+	}
+
+	override := func(limit *int, value *int) {
+		if value != nil {
+			*limit = *value
+		}
+	}
+	override(&quota.MaxBots, stored.MaxBots)
+	override(&quota.MaxInstrumentsPerBot, stored.MaxInstrumentsPerBot)
+	override(&quota.MaxInstruments, stored.MaxInstruments)
+	override(&quota.MaxCallsPerMinute, stored.MaxCallsPerMinute)
+
+	return quota, nil
+}
+
+// SetQuota stores the limits of a user overriding the defaults, a nil limit
+// uses the default
+func (s *QuotaService) SetQuota(quota *models.Quota) error {
+	if err := s.repo.UpsertQuota(quota); err != nil {
+		return fmt.Errorf("failed to store quota: %w", err)
+	}
+
+	s.mu.Lock()
+	delete(s.quotas, quota.UserID)
+	s.mu.Unlock()
+	return nil
+}
+
+// AllowCall records a start or stop call of a user. If the user already made
+// the maximum calls in the last minute the call is not recorded, and the time
+// until the next call is allowed is returned with ErrQuotaExceeded
+func (s *QuotaService) AllowCall(userID string) (time.Duration, error) {
+	quota, err := s.GetQuota(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweepLocked(now)
+	calls := pruneCalls(s.calls[userID], now)
+
+	if quota.MaxCallsPerMinute > 0 && len(calls) >= quota.MaxCallsPerMinute {
+		s.calls[userID] = calls
+		retryAfter := calls[0].Add(quotaCallWindow).Sub(now)
+		return retryAfter, fmt.Errorf("%w: max %d start and stop calls per minute", ErrQuotaExceeded, quota.MaxCallsPerMinute)
+	}
+
+	s.calls[userID] = append(calls, now)
+	return 0, nil
+}
+
+// CallsInWindow returns the number of start and stop calls of a user in the
+// last minute
+func (s *QuotaService) CallsInWindow(userID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	calls := pruneCalls(s.calls[userID], time.Now())
+	if len(calls) == 0 {
+		delete(s.calls, userID)
+	} else {
+		s.calls[userID] = calls
+	}
+	return len(calls)
+}
+
+// sweepLocked drops the users without calls in the window and the expired
+// quotas, at most once a window
+func (s *QuotaService) sweepLocked(now time.Time) {
+	if now.Sub(s.lastSweep) < quotaCallWindow {
+		return
+	}
+	s.lastSweep = now
+
+	for userID, calls := range s.calls {
+		if len(pruneCalls(calls, now)) == 0 {
+			delete(s.calls, userID)
+		}
+	}
+	for userID, cached := range s.quotas {
+		if !now.Before(cached.expiresAt) {
+			delete(s.quotas, userID)
+		}
+	}
+}
+
+// pruneCalls drops the calls older than the window, calls are in time order
+func pruneCalls(calls []time.Time, now time.Time) []time.Time {
+	cutoff := now.Add(-quotaCallWindow)
+	i := 0
+	for i < len(calls) && !calls[i].After(cutoff) {
+		i++
+	}
+	return calls[i:]
+}
+
+// checkQuota checks that a user can start a bot with instruments, given the
+// bots and instruments the user is running
+func checkQuota(quota Quota, runningBots, runningInstruments, instruments int) error {
+	if quota.MaxBots > 0 && runningBots >= quota.MaxBots {
+		return fmt.Errorf("%w: max %d bots running", ErrQuotaExceeded, quota.MaxBots)
+	}
+	if quota.MaxInstrumentsPerBot > 0 && instruments > quota.MaxInstrumentsPerBot {
+		return fmt.Errorf("%w: max %d instruments per bot, requested %d", ErrQuotaExceeded, quota.MaxInstrumentsPerBot, instruments)
+	}
+	if quota.MaxInstruments > 0 && runningInstruments+instruments > quota.MaxInstruments {
+		return fmt.Errorf("%w: max %d instruments in total, %d running, requested %d", ErrQuotaExceeded, quota.MaxInstruments, runningInstruments, instruments)
+	}
+	return nil
+}
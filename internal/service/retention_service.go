@@ -0,0 +1,251 @@
+package service
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nsvirk/moneybotstds/internal/config"
+	"github.com/nsvirk/moneybotstds/internal/logger"
+	"github.com/nsvirk/moneybotstds/internal/metrics"
+	"github.com/nsvirk/moneybotstds/internal/models"
+	"github.com/nsvirk/moneybotstds/internal/repository"
+	"gorm.io/gorm"
+)
+
+// retentionTables are the tables retention rules can be set for, by the name
+// used in the rules
+var retentionTables = map[string]string{
+	"logs":        models.LogsTable,
+	"ticker_logs": models.TickerLogsTable,
+}
+
+// Rows deleted per statement, so pruning does not hold long locks
+const pruneBatchSize = 5000
+
+// RetentionRule keeps the rows of a logs table, or of a level of the table,
+// for MaxAge. A MaxAge of 0 keeps them forever
+type RetentionRule struct {
+	Table  string
+	Level  string
+	MaxAge time.Duration
+}
+
+// ParseRetentionRules parses comma separated `<table>[:<level>]=<age>` rules.
+// The age is a number of days like `30d`, a duration like `12h`, or `off`. A
+// spec of `off` has no rules, keeping all rows
+func ParseRetentionRules(spec string) ([]RetentionRule, error) {
+	if strings.TrimSpace(spec) == "off" {
+		return nil, nil
+	}
+
+	var rules []RetentionRule
+	seen := make(map[string]bool)
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		target, age, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid retention rule %q, must be <table>[:<level>]=<age>", part)
+		}
+
+		var rule RetentionRule
+		rule.Table, rule.Level, _ = strings.Cut(strings.TrimSpace(target), ":")
+		if _, ok := retentionTables[rule.Table]; !ok {
+			return nil, fmt.Errorf("invalid retention rule %q, unknown table %s", part, rule.Table)
+		}
+		if rule.Level != "" {
+			level, err := logger.ParseLevel(rule.Level)
+			if err != nil {
+				return nil, fmt.Errorf("invalid retention rule %q: %w", part, err)
+			}
+			rule.Level = logger.LevelName(level)
+		}
+
+		maxAge, err := parseRetentionAge(strings.TrimSpace(age))
+		if err != nil {
+			return nil, fmt.Errorf("invalid retention rule %q: %w", part, err)
+		}
+		rule.MaxAge = maxAge
+
+		key := rule.Table + ":" + rule.Level
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate retention rule for %s", strings.TrimSuffix(key, ":"))
+		}
+		seen[key] = true
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func parseRetentionAge(age string) (time.Duration, error) {
+	if age == "off" || age == "0" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(age, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid age %s", age)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(age)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid age %s", age)
+	}
+	return d, nil
+}
+
+// RetentionService prunes the expired rows of the logs tables, optionally
+// archiving them to gzipped JSON lines files first
+type RetentionService struct {
+	repo       *repository.Repository
+	rules      []RetentionRule
+	archiveDir string
+	appLogger  *logger.AppLogger
+}
+
+// NewRetentionService creates a new RetentionService with the configured rules
+func NewRetentionService(cfg *config.Config, db *gorm.DB) (*RetentionService, error) {
+	rules, err := ParseRetentionRules(cfg.LogRetention)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.LogArchiveDir != "" {
+		if err := os.MkdirAll(cfg.LogArchiveDir, 0o750); err != nil {
+			return nil, fmt.Errorf("failed to create log archive directory: %w", err)
+		}
+	}
+
+	return &RetentionService{
+		repo:       repository.NewRepository(db),
+		rules:      rules,
+		archiveDir: cfg.LogArchiveDir,
+		appLogger:  logger.NewAppLogger(db),
+	}, nil
+}
+
+// excludedLevels returns the levels a rule does not apply to, those of the
+// table with their own rule if it is a table rule
+func excludedLevels(rules []RetentionRule, rule RetentionRule) []string {
+	if rule.Level != "" {
+		return nil
+	}
+	var levels []string
+	for _, other := range rules {
+		if other.Table == rule.Table && other.Level != "" {
+			levels = append(levels, other.Level)
+		}
+	}
+	return levels
+}
+
+// Prune deletes the expired rows of every rule and returns the number of rows
+// deleted by table. A table rule does not apply to the levels with their own
+// rule
+func (s *RetentionService) Prune() (map[string]int, error) {
+	pruned := make(map[string]int)
+	now := time.Now()
+
+	for _, rule := range s.rules {
+		if rule.MaxAge == 0 {
+			continue
+		}
+
+		excludeLevels := excludedLevels(s.rules, rule)
+
+		var archive func([]map[string]interface{}) error
+		if s.archiveDir != "" {
+			archive = func(rows []map[string]interface{}) error {
+				return s.archive(rule.Table, rows)
+			}
+		}
+
+		before := now.Add(-rule.MaxAge)
+		for {
+			n, err := s.repo.PruneLogs(retentionTables[rule.Table], before, rule.Level, excludeLevels, pruneBatchSize, archive)
+			pruned[rule.Table] += n
+			metrics.LogRowsPruned.WithLabelValues(rule.Table).Add(float64(n))
+			if err != nil {
+				return pruned, fmt.Errorf("failed to prune %s: %w", rule.Table, err)
+			}
+			if n < pruneBatchSize {
+				break
+			}
+		}
+	}
+
+	return pruned, nil
+}
+
+// RunPruneJob prunes now and then every interval until ctx is cancelled
+func (s *RetentionService) RunPruneJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.pruneAndLog()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *RetentionService) pruneAndLog() {
+	pruned, err := s.Prune()
+	if err != nil {
+		s.appLogger.Error("Failed to prune logs", "error", err)
+	}
+	if pruned["logs"] > 0 || pruned["ticker_logs"] > 0 {
+		s.appLogger.Info("Logs pruned", "logs", pruned["logs"], "ticker_logs", pruned["ticker_logs"])
+	}
+}
+
+// archive writes rows to `<table>-<first id>-<last id>.jsonl.gz` in the
+// archive directory. The file is written under a temporary name and renamed
+// once complete, so a failed archive leaves no partial file
+func (s *RetentionService) archive(table string, rows []map[string]interface{}) error {
+	name := fmt.Sprintf("%s-%v-%v.jsonl.gz", table, rows[0]["id"], rows[len(rows)-1]["id"])
+	path := filepath.Join(s.archiveDir, name)
+
+	f, err := os.CreateTemp(s.archiveDir, name+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	enc := json.NewEncoder(gz)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	return os.Rename(f.Name(), path)
+}
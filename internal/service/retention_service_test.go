@@ -0,0 +1,128 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRetentionRules(t *testing.T) {
+	const day = 24 * time.Hour
+
+	tests := []struct {
+		name    string
+		spec    string
+		want    []RetentionRule
+		wantErr string
+	}{
+		{
+			name: "off",
+			spec: "off",
+		},
+		{
+			name: "empty",
+			spec: "",
+		},
+		{
+			name: "tables",
+			spec: "logs=30d,ticker_logs=12h",
+			want: []RetentionRule{
+				{Table: "logs", MaxAge: 30 * day},
+				{Table: "ticker_logs", MaxAge: 12 * time.Hour},
+			},
+		},
+		{
+			name: "levels",
+			spec: " logs=30d , logs:debug=3d,ticker_logs:ERROR=off,",
+			want: []RetentionRule{
+				{Table: "logs", MaxAge: 30 * day},
+				{Table: "logs", Level: "DEBUG", MaxAge: 3 * day},
+				{Table: "ticker_logs", Level: "ERROR"},
+			},
+		},
+		{
+			name: "zero keeps forever",
+			spec: "logs=0",
+			want: []RetentionRule{{Table: "logs"}},
+		},
+		{
+			name:    "missing age",
+			spec:    "logs",
+			wantErr: "must be <table>[:<level>]=<age>",
+		},
+		{
+			name:    "unknown table",
+			spec:    "audit_logs=30d",
+			wantErr: "unknown table audit_logs",
+		},
+		{
+			name:    "unknown level",
+			spec:    "logs:TRACE=1d",
+			wantErr: "invalid log level: TRACE",
+		},
+		{
+			name:    "invalid days",
+			spec:    "logs=-1d",
+			wantErr: "invalid age -1d",
+		},
+		{
+			name:    "invalid duration",
+			spec:    "logs=soon",
+			wantErr: "invalid age soon",
+		},
+		{
+			name:    "duplicate table",
+			spec:    "logs=30d,logs=10d",
+			wantErr: "duplicate retention rule for logs",
+		},
+		{
+			name:    "duplicate level",
+			spec:    "logs:warn=30d,logs:WARN=10d",
+			wantErr: "duplicate retention rule for logs:WARN",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRetentionRules(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseRetentionRules() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRetentionRules() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRetentionRules() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExcludedLevels(t *testing.T) {
+	rules, err := ParseRetentionRules("logs=30d,logs:DEBUG=3d,logs:ERROR=off,ticker_logs=14d,ticker_logs:WARN=7d")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		rule RetentionRule
+		want []string
+	}{
+		{"table rule", rules[0], []string{"DEBUG", "ERROR"}},
+		{"level rule", rules[1], nil},
+		{"other table", rules[3], []string{"WARN"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := excludedLevels(rules, tt.rule); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("excludedLevels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrTickerNotRunning is returned when a bot has no running ticker
+var ErrTickerNotRunning = errors.New("ticker not running")
+
+// ErrTickerRunning is returned when starting a bot whose ticker is running or
+// starting
+var ErrTickerRunning = errors.New("ticker already running")
+
+// Number of latest ticks the latency distributions are computed over, of each
+// instrument and of each bot
+const (
+	instrumentLatencySamples = 128
+	botLatencySamples        = 1024
+)
+
+// An instrument is flagged slow once more than 1/slowRatio of its latest
+// ticks, at least minSlowSamples, are above the threshold, i.e. its p90 is
+// above it, and recovers once fewer than 1/recoverRatio are
+const (
+	minSlowSamples = 20
+	slowRatio      = 10
+	recoverRatio   = 20
+)
+
+// LatencyStats is the latency distribution of the latest ticks
+type LatencyStats struct {
+	Count int
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// InstrumentLatency is the latency of the ticks of one instrument, from the
+// exchange timestamp to the Redis publish
+type InstrumentLatency struct {
+	Instrument string
+	Token      uint32
+	Last       time.Duration
+	Total      LatencyStats
+	Slow       bool
+	SlowSince  time.Time
+}
+
+// TickerLatency is the latency of the ticks of a bot, by stage: Feed is from
+// the exchange timestamp to the receive from Kite, Publish is from the
+// receive to the Redis publish and Total is from the exchange timestamp to
+// the Redis publish
+type TickerLatency struct {
+	UserID      string
+	BotID       string
+	Threshold   time.Duration
+	Feed        LatencyStats
+	Publish     LatencyStats
+	Total       LatencyStats
+	Instruments []InstrumentLatency
+}
+
+// latencyWindow is a ring of the latest latency samples, counting the samples
+// above a threshold
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+	full    bool
+	over    int
+}
+
+func newLatencyWindow(size int) *latencyWindow {
+	return &latencyWindow{samples: make([]time.Duration, size)}
+}
+
+// add records a sample, replacing the oldest once the window is full
+func (w *latencyWindow) add(d, threshold time.Duration) {
+	if w.full && threshold > 0 && w.samples[w.next] > threshold {
+		w.over--
+	}
+	if threshold > 0 && d > threshold {
+		w.over++
+	}
+
+	w.samples[w.next] = d
+	w.next++
+	if w.next == len(w.samples) {
+		w.next = 0
+		w.full = true
+	}
+}
+
+func (w *latencyWindow) len() int {
+	if w.full {
+		return len(w.samples)
+	}
+	return w.next
+}
+
+// stats returns the distribution of the samples in the window
+func (w *latencyWindow) stats() LatencyStats {
+	n := w.len()
+	if n == 0 {
+		return LatencyStats{}
+	}
+
+	sorted := slices.Clone(w.samples[:n])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	// Nearest rank, so the p90 is above a threshold exactly when more than
+	// a tenth of the samples are
+	quantile := func(q float64) time.Duration {
+		return sorted[int(math.Ceil(q*float64(n)))-1]
+	}
+	return LatencyStats{
+		Count: n,
+		P50:   quantile(0.5),
+		P90:   quantile(0.9),
+		P99:   quantile(0.99),
+		Max:   sorted[n-1],
+	}
+}
+
+type instrumentLatency struct {
+	total     *latencyWindow
+	last      time.Duration
+	slow      bool
+	slowSince time.Time
+}
+
+// tickLatency tracks the latency of the ticks of a ticker. It is written by
+// the ticker goroutine and read by the status routes
+type tickLatency struct {
+	threshold time.Duration
+
+	mu          sync.Mutex
+	feed        *latencyWindow
+	publish     *latencyWindow
+	total       *latencyWindow
+	instruments map[uint32]*instrumentLatency
+	slow        int
+}
+
+func newTickLatency(threshold time.Duration) *tickLatency {
+	return &tickLatency{
+		threshold:   threshold,
+		feed:        newLatencyWindow(botLatencySamples),
+		publish:     newLatencyWindow(botLatencySamples),
+		total:       newLatencyWindow(botLatencySamples),
+		instruments: make(map[uint32]*instrumentLatency),
+	}
+}
+
+// latencyChange is an instrument that became slow or recovered
+type latencyChange struct {
+	slow bool
+	p90  time.Duration
+}
+
+// record records the latency of a published tick. Ticks without an exchange
+// timestamp only count in the publish stage. If the instrument became slow or
+// recovered the change is returned
+func (l *tickLatency) record(token uint32, exchangeAt, receivedAt, publishedAt time.Time) *latencyChange {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.publish.add(publishedAt.Sub(receivedAt), 0)
+	if exchangeAt.IsZero() {
+		return nil
+	}
+
+	// Exchange timestamps are whole seconds and clocks drift, so latencies
+	// below zero are counted as zero
+	feed := max(receivedAt.Sub(exchangeAt), 0)
+	total := max(publishedAt.Sub(exchangeAt), 0)
+	l.feed.add(feed, 0)
+	l.total.add(total, 0)
+
+	inst, ok := l.instruments[token]
+	if !ok {
+		inst = &instrumentLatency{total: newLatencyWindow(instrumentLatencySamples)}
+		l.instruments[token] = inst
+	}
+	inst.total.add(total, l.threshold)
+	inst.last = total
+
+	n := inst.total.len()
+	switch {
+	case !inst.slow && n >= minSlowSamples && inst.total.over*slowRatio > n:
+		inst.slow = true
+		inst.slowSince = publishedAt
+		l.slow++
+	case inst.slow && inst.total.over*recoverRatio < n:
+		inst.slow = false
+		inst.slowSince = time.Time{}
+		l.slow--
+	default:
+		return nil
+	}
+	return &latencyChange{slow: inst.slow, p90: inst.total.stats().P90}
+}
+
+// slowCount returns the number of instruments flagged slow
+func (l *tickLatency) slowCount() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.slow
+}
+
+// snapshot returns the latency of the ticker, instruments are named by
+// tokenMap and the slow ones listed first
+func (l *tickLatency) snapshot(tokenMap map[uint32]string) TickerLatency {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	latency := TickerLatency{
+		Threshold:   l.threshold,
+		Feed:        l.feed.stats(),
+		Publish:     l.publish.stats(),
+		Total:       l.total.stats(),
+		Instruments: make([]InstrumentLatency, 0, len(l.instruments)),
+	}
+	for token, inst := range l.instruments {
+		latency.Instruments = append(latency.Instruments, InstrumentLatency{
+			Instrument: tokenMap[token],
+			Token:      token,
+			Last:       inst.last,
+			Total:      inst.total.stats(),
+			Slow:       inst.slow,
+			SlowSince:  inst.slowSince,
+		})
+	}
+	sort.Slice(latency.Instruments, func(i, j int) bool {
+		a, b := latency.Instruments[i], latency.Instruments[j]
+		if a.Slow != b.Slow {
+			return a.Slow
+		}
+		return a.Instrument < b.Instrument
+	})
+	return latency
+}
+
+// TickerLatency returns the tick latency of the running ticker of a bot
+func (s *TickerService) TickerLatency(userID, botID string) (*TickerLatency, error) {
+	s.mu.Lock()
+	instance, ok := s.tickers[fmt.Sprintf("%s:%s", userID, botID)]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrTickerNotRunning
+	}
+
+	latency := instance.Latency.snapshot(instance.TokenMap)
+	latency.UserID = userID
+	latency.BotID = botID
+	return &latency, nil
+}
+
+// recordLatency records the latency of a tick published at publishedAt, after
+// Redis accepted it, flagging the instrument in the metrics, logs and events of
+// the bot when it becomes slow or recovers
+func (s *TickerService) recordLatency(userID, botID string, instance *TickerInstance, token uint32, tick Tick, publishedAt time.Time) {
+	exchangeAt := tick.ExchangeTimestamp
+	instance.Metrics.PublishLatency.Observe(publishedAt.Sub(tick.ReceivedAt).Seconds())
+	if !exchangeAt.IsZero() {
+		instance.Metrics.FeedLatency.Observe(max(tick.ReceivedAt.Sub(exchangeAt), 0).Seconds())
+		instance.Metrics.TotalLatency.Observe(max(publishedAt.Sub(exchangeAt), 0).Seconds())
+	}
+
+	change := instance.Latency.record(token, exchangeAt, tick.ReceivedAt, publishedAt)
+	if change == nil {
+		return
+	}
+	instance.Metrics.SlowInstruments.Set(float64(instance.Latency.slowCount()))
+
+	instrument := instance.TokenMap[token]
+	event := TickerEvent{
+		Type:        EventLatencyNormal,
+		Tokens:      []uint32{token},
+		Instruments: []string{instrument},
+		LatencyMs:   change.p90.Milliseconds(),
+	}
+	if change.slow {
+		event.Type = EventLatencyHigh
+		event.Message = fmt.Sprintf("p90 latency of %s is %v, above %v", instrument, change.p90, instance.Latency.threshold)
+		s.logTickerEvent(userID, botID, "WARN", "TickLatency", event.Message)
+	} else {
+		event.Message = fmt.Sprintf("p90 latency of %s is %v, back below %v", instrument, change.p90, instance.Latency.threshold)
+		s.logTickerEvent(userID, botID, "INFO", "TickLatency", event.Message)
+	}
+	s.publishEvent(userID, botID, event)
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLatencyWindowStats(t *testing.T) {
+	ms := func(values ...int) []time.Duration {
+		durations := make([]time.Duration, len(values))
+		for i, v := range values {
+			durations[i] = time.Duration(v) * time.Millisecond
+		}
+		return durations
+	}
+
+	tests := []struct {
+		name      string
+		size      int
+		samples   []time.Duration
+		threshold time.Duration
+		want      LatencyStats
+		wantOver  int
+	}{
+		{
+			name: "empty",
+			size: 10,
+		},
+		{
+			name:    "one sample",
+			size:    10,
+			samples: ms(7),
+			want:    LatencyStats{Count: 1, P50: 7 * time.Millisecond, P90: 7 * time.Millisecond, P99: 7 * time.Millisecond, Max: 7 * time.Millisecond},
+		},
+		{
+			name:      "nearest rank",
+			size:      10,
+			samples:   ms(10, 1, 9, 2, 8, 3, 7, 4, 6, 5),
+			threshold: 8 * time.Millisecond,
+			want:      LatencyStats{Count: 10, P50: 5 * time.Millisecond, P90: 9 * time.Millisecond, P99: 10 * time.Millisecond, Max: 10 * time.Millisecond},
+			wantOver:  2,
+		},
+		{
+			name:      "oldest samples replaced",
+			size:      4,
+			samples:   ms(50, 60, 1, 2, 3, 4),
+			threshold: 10 * time.Millisecond,
+			want:      LatencyStats{Count: 4, P50: 2 * time.Millisecond, P90: 4 * time.Millisecond, P99: 4 * time.Millisecond, Max: 4 * time.Millisecond},
+			wantOver:  0,
+		},
+		{
+			name:      "without threshold",
+			size:      4,
+			samples:   ms(50, 60),
+			threshold: 0,
+			want:      LatencyStats{Count: 2, P50: 50 * time.Millisecond, P90: 60 * time.Millisecond, P99: 60 * time.Millisecond, Max: 60 * time.Millisecond},
+			wantOver:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newLatencyWindow(tt.size)
+			for _, sample := range tt.samples {
+				w.add(sample, tt.threshold)
+			}
+			if got := w.stats(); got != tt.want {
+				t.Errorf("stats() = %+v, want %+v", got, tt.want)
+			}
+			if w.over != tt.wantOver {
+				t.Errorf("over = %d, want %d", w.over, tt.wantOver)
+			}
+		})
+	}
+}
+
+func TestTickLatencySlow(t *testing.T) {
+	const threshold = 100 * time.Millisecond
+	slow, fast := 200*time.Millisecond, 10*time.Millisecond
+
+	type run struct {
+		latency time.Duration
+		ticks   int
+	}
+	type change struct {
+		tick int
+		slow bool
+	}
+
+	tests := []struct {
+		name string
+		runs []run
+		want []change
+	}{
+		{
+			name: "too few ticks",
+			runs: []run{{slow, minSlowSamples - 1}},
+		},
+		{
+			name: "slow once enough ticks",
+			runs: []run{{slow, minSlowSamples + 10}},
+			want: []change{{minSlowSamples, true}},
+		},
+		{
+			name: "a tenth slow is not slow",
+			runs: []run{{slow, 2}, {fast, 18}},
+		},
+		{
+			name: "more than a tenth slow",
+			runs: []run{{slow, 2}, {fast, 18}, {slow, 1}},
+			want: []change{{21, true}},
+		},
+		{
+			name: "stays slow until below a twentieth",
+			runs: []run{{slow, 2}, {fast, 18}, {slow, 1}, {fast, 40}},
+			want: []change{{21, true}, {61, false}},
+		},
+		{
+			name: "recovers once the slow ticks leave the window",
+			runs: []run{{slow, 20}, {fast, 130}},
+			want: []change{{20, true}, {142, false}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTickLatency(threshold)
+			exchangeAt := time.Date(2025, 1, 6, 10, 0, 0, 0, time.UTC)
+
+			var got []change
+			tick := 0
+			for _, r := range tt.runs {
+				for range r.ticks {
+					tick++
+					receivedAt := exchangeAt.Add(r.latency - time.Millisecond)
+					if c := l.record(1, exchangeAt, receivedAt, exchangeAt.Add(r.latency)); c != nil {
+						got = append(got, change{tick, c.slow})
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("changes = %v, want %v", got, tt.want)
+			}
+
+			wantSlow := 0
+			if len(tt.want) > 0 && tt.want[len(tt.want)-1].slow {
+				wantSlow = 1
+			}
+			if n := l.slowCount(); n != wantSlow {
+				t.Errorf("slowCount() = %d, want %d", n, wantSlow)
+			}
+		})
+	}
+}
+
+func TestTickLatencyRecord(t *testing.T) {
+	l := newTickLatency(100 * time.Millisecond)
+	at := time.Date(2025, 1, 6, 10, 0, 0, 0, time.UTC)
+
+	// Without an exchange timestamp only the publish stage counts
+	l.record(1, time.Time{}, at, at.Add(2*time.Millisecond))
+	// A clock behind the exchange counts as zero
+	l.record(2, at.Add(time.Second), at, at.Add(3*time.Millisecond))
+
+	latency := l.snapshot(map[uint32]string{2: "NSE:INFY"})
+	if latency.Publish.Count != 2 || latency.Publish.Max != 3*time.Millisecond {
+		t.Errorf("Publish = %+v, want 2 samples up to 3ms", latency.Publish)
+	}
+	if latency.Feed.Count != 1 || latency.Feed.Max != 0 || latency.Total.Max != 0 {
+		t.Errorf("Feed = %+v, Total = %+v, want one zero sample", latency.Feed, latency.Total)
+	}
+	if len(latency.Instruments) != 1 || latency.Instruments[0].Instrument != "NSE:INFY" {
+		t.Errorf("Instruments = %+v, want NSE:INFY only", latency.Instruments)
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Ticker event types published on the events channel of a bot
+const (
+	EventStarted        = "started"
+	EventStopped        = "stopped"
+	EventConnect        = "connect"
+	EventClose          = "close"
+	EventReconnect      = "reconnect"
+	EventNoReconnect    = "no_reconnect"
+	EventError          = "error"
+	EventSubscribe      = "subscribe"
+	EventUnsubscribe    = "unsubscribe"
+	EventSessionExpired = "session_expired"
+	EventLatencyHigh    = "latency_high"
+	EventLatencyNormal  = "latency_normal"
+	EventFeedStale      = "feed_stale"
+	EventFeedRecovered  = "feed_recovered"
+	EventScheduled      = "scheduled"
+	EventPreOpen        = "pre_open"
+	EventMarketOpen     = "market_open"
+	EventMarketClose    = "market_close"
+	EventSettlement     = "settlement"
+)
+
+// TickerEvent is a change in the state of a ticker, published as JSON on
+// `CH:EVENTS:<user_id>:<bot_id>`. Fields not relevant to the event type are
+// omitted
+type TickerEvent struct {
+	Type        string
+	UserID      string
+	BotID       string
+	Message     string     `json:",omitempty"`
+	Code        int        `json:",omitempty"` // close code
+	Reason      string     `json:",omitempty"` // close reason
+	Attempt     int        `json:",omitempty"` // reconnect attempt
+	DelayMs     int64      `json:",omitempty"` // delay before the reconnect attempt
+	Mode        string     `json:",omitempty"` // subscription mode
+	Tokens      []uint32   `json:",omitempty"` // subscribed or unsubscribed tokens
+	Instruments []string   `json:",omitempty"` // exchange:tradingsymbol of the tokens
+	LatencyMs   int64      `json:",omitempty"` // p90 tick latency of the instruments
+	StartsAt    *time.Time `json:",omitempty"` // next start of a scheduled ticker
+	Exchange    string     `json:",omitempty"` // exchange of a market event
+	Session     string     `json:",omitempty"` // session of a market event
+	PublishedAt time.Time
+}
+
+// publishEvent publishes a ticker event on the events channel of a bot and
+// notifies its webhooks
+func (s *TickerService) publishEvent(userID, botID string, event TickerEvent) {
+	event.UserID = userID
+	event.BotID = botID
+	event.PublishedAt = time.Now()
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		s.logTickerEvent(userID, botID, "ERROR", "PublishEvent", fmt.Sprintf("Failed to marshal event: %v", err))
+		return
+	}
+
+	if err := s.redisClient.Publish(context.Background(), s.GetEventsChannel(userID, botID), eventJSON); err != nil {
+		s.logTickerEvent(userID, botID, "ERROR", "PublishEvent", fmt.Sprintf("Failed to publish %s event: %v", event.Type, err))
+	}
+
+	s.webhookService.Notify(event)
+}
+
+// subscriptionEvent makes a subscribe or unsubscribe event for tokens
+func subscriptionEvent(eventType, mode string, tokens []uint32, instance *TickerInstance) TickerEvent {
+	var instruments []string
+	for _, token := range tokens {
+		if instrument, ok := instance.TokenMap[token]; ok {
+			instruments = append(instruments, instrument)
+		}
+	}
+
+	return TickerEvent{
+		Type:        eventType,
+		Mode:        mode,
+		Tokens:      tokens,
+		Instruments: instruments,
+	}
+}
+
+// GetEventsChannel returns the channel ticker events of a bot are published on
+func (s *TickerService) GetEventsChannel(userID, botID string) string {
+	return fmt.Sprintf("CH:EVENTS:%s:%s", userID, botID)
+}
@@ -0,0 +1,349 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nsvirk/moneybotstds/internal/market"
+	"github.com/nsvirk/moneybotstds/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrNoTradingSession is returned when scheduling a ticker whose exchanges
+// hold no session in the days looked ahead
+var ErrNoTradingSession = errors.New("no trading session in the next two weeks")
+
+// Days looked ahead for the next trading session of a scheduled ticker
+const scheduleLookahead = 14
+
+// scheduleCheckInterval is how often the scheduler starts and stops tickers
+const scheduleCheckInterval = 30 * time.Second
+
+// Scheduled tickers that fail to start are retried after a backoff doubling
+// from the check interval up to scheduleMaxBackoff, and taken off the schedule
+// after scheduleMaxFailures failures in a row. At most scheduleStartWorkers
+// tickers are started at once
+const (
+	scheduleMaxBackoff   = 15 * time.Minute
+	scheduleMaxFailures  = 8
+	scheduleStartWorkers = 8
+)
+
+// scheduleRetry is the failed starts of a scheduled ticker in a row
+type scheduleRetry struct {
+	failures int
+	next     time.Time
+}
+
+// scheduledStart is the outcome of starting a scheduled ticker
+type scheduledStart struct {
+	userID string
+	botID  string
+	err    error
+}
+
+// Schedule runs a ticker during the trading hours of the exchanges of its
+// instruments, starting BeforeOpen before the first session opens and stopping
+// AfterClose after the last one closes each trading day
+type Schedule struct {
+	BeforeOpen time.Duration
+	AfterClose time.Duration
+}
+
+// tickerExchanges returns the exchanges of the instruments of a ticker
+func tickerExchanges(tickerInstruments []models.TickerInstrument) []string {
+	var exchanges []string
+	for _, inst := range tickerInstruments {
+		if !slices.Contains(exchanges, inst.Exchange) {
+			exchanges = append(exchanges, inst.Exchange)
+		}
+	}
+	return exchanges
+}
+
+// scheduleWindow returns the current or next window a scheduled ticker of
+// exchanges runs in. ok is false if none is held in the days looked ahead
+func (s *TickerService) scheduleWindow(schedule *Schedule, exchanges []string, now time.Time) (start, end time.Time, ok bool) {
+	day := now.In(market.IST)
+	// The window of the day before may end after midnight
+	for i := -1; i <= scheduleLookahead; i++ {
+		open, close, held := s.calendar.TradingHours(exchanges, day.AddDate(0, 0, i))
+		if !held {
+			continue
+		}
+		start, end = open.Add(-schedule.BeforeOpen), close.Add(schedule.AfterClose)
+		if now.Before(end) {
+			return start, end, true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// ScheduleTicker starts a ticker with a schedule now if it is within its
+// trading hours, otherwise records it as scheduled and returns the time it
+// starts. The ticker is started later with the stored enctoken of the user,
+// so credential storage must be configured
+func (s *TickerService) ScheduleTicker(ctx context.Context, userID, enctoken, botID string, tickerInstruments []models.TickerInstrument, opts TickerOptions) (time.Time, error) {
+	now := time.Now()
+	start, _, ok := s.scheduleWindow(opts.Schedule, tickerExchanges(tickerInstruments), now)
+	if !ok {
+		return time.Time{}, ErrNoTradingSession
+	}
+	if !now.Before(start) {
+		return time.Time{}, s.StartTicker(ctx, userID, enctoken, botID, tickerInstruments, opts)
+	}
+
+	if err := s.CheckSchedule(userID, botID, len(tickerInstruments)); err != nil {
+		return time.Time{}, err
+	}
+
+	// Check there is an enctoken to start with, storing the given one
+	if enctoken == "" {
+		if _, err := s.loadEnctoken(ctx, userID); err != nil {
+			return time.Time{}, err
+		}
+	} else if err := s.SaveCredential(userID, enctoken); err != nil {
+		return time.Time{}, err
+	}
+
+	if err := s.saveTickerState(ctx, userID, botID, TickerStatusScheduled, opts); err != nil {
+		return time.Time{}, fmt.Errorf("failed to store ticker state: %w", err)
+	}
+
+	message := fmt.Sprintf("Ticker scheduled to start at %s", start.In(market.IST).Format(time.RFC3339))
+	s.logTickerEvent(userID, botID, "INFO", "ScheduleTicker", message)
+	s.publishEvent(userID, botID, TickerEvent{Type: EventScheduled, Message: message, StartsAt: &start})
+
+	return start, nil
+}
+
+// CheckSchedule checks that a bot can be scheduled with instruments, like
+// CheckStart. The other scheduled bots of the user count toward the quota as if
+// running, so they can all start at the open
+func (s *TickerService) CheckSchedule(userID, botID string, instruments int) error {
+	quota, err := s.quotaService.GetQuota(userID)
+	if err != nil {
+		return err
+	}
+	scheduled, err := s.repo.GetTickersByStatus(TickerStatusScheduled)
+	if err != nil {
+		return fmt.Errorf("failed to get scheduled tickers: %w", err)
+	}
+	scheduledInstruments := make(map[string]int)
+	for _, ticker := range scheduled {
+		if ticker.UserID != userID || ticker.BotID == botID {
+			continue
+		}
+		tickerInstruments, err := s.repo.GetTickerInstruments(ticker.BotID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get instruments: %w", err)
+		}
+		scheduledInstruments[fmt.Sprintf("%s:%s", userID, ticker.BotID)] = len(tickerInstruments)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key := fmt.Sprintf("%s:%s", userID, botID); s.tickers[key] != nil || s.stopping[key] {
+		return fmt.Errorf("%w for user %s and bot %s", ErrTickerRunning, userID, botID)
+	}
+	bots, usedInstruments := s.usageLocked(userID)
+	for key, n := range scheduledInstruments {
+		// Scheduled tickers starting now are counted by usageLocked
+		if _, starting := s.starting[key]; starting {
+			continue
+		}
+		if _, running := s.tickers[key]; running {
+			continue
+		}
+		bots++
+		usedInstruments += n
+	}
+	return checkQuota(quota, bots, usedInstruments, instruments)
+}
+
+// unscheduleTicker records a scheduled ticker as stopped, reporting whether
+// the bot had one
+func (s *TickerService) unscheduleTicker(userID, botID string) (bool, error) {
+	ticker, err := s.repo.GetTicker(userID, botID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get ticker: %w", err)
+	}
+	if ticker.Status != TickerStatusScheduled {
+		return false, nil
+	}
+
+	now := time.Now()
+	if err := s.repo.UpdateTickerStatus(userID, botID, TickerStatusStopped, &now); err != nil {
+		return false, fmt.Errorf("failed to store ticker state: %w", err)
+	}
+
+	s.logTickerEvent(userID, botID, "INFO", "StopTicker", "Ticker unscheduled")
+	s.publishEvent(userID, botID, TickerEvent{Type: EventStopped, Message: "Ticker unscheduled"})
+	return true, nil
+}
+
+// RunScheduler starts and stops the scheduled tickers with their trading
+// hours until ctx is cancelled
+func (s *TickerService) RunScheduler(ctx context.Context) {
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.stopScheduled(now)
+			s.startScheduled(ctx, now)
+		}
+	}
+}
+
+// stopScheduled stops the running scheduled tickers whose trading hours ended,
+// recording them as scheduled for the next trading day
+func (s *TickerService) stopScheduled(now time.Time) {
+	s.mu.Lock()
+	var instances []*TickerInstance
+	for _, instance := range s.tickers {
+		if instance.Schedule != nil {
+			instances = append(instances, instance)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, instance := range instances {
+		start, _, ok := s.scheduleWindow(instance.Schedule, instance.Exchanges, now)
+		if ok && !now.Before(start) {
+			continue
+		}
+
+		event := TickerEvent{Type: EventScheduled, Message: "Trading hours ended, " + ErrNoTradingSession.Error()}
+		if ok {
+			event.Message = fmt.Sprintf("Trading hours ended, ticker scheduled to start at %s", start.In(market.IST).Format(time.RFC3339))
+			event.StartsAt = &start
+		}
+		err := s.stopTicker(instance.UserID, instance.BotID, TickerStatusScheduled, event)
+		if err != nil && !errors.Is(err, ErrTickerNotRunning) {
+			s.logTickerEvent(instance.UserID, instance.BotID, "ERROR", "Scheduler", fmt.Sprintf("Failed to stop ticker: %v", err))
+		}
+	}
+}
+
+// startScheduled starts the stored scheduled tickers whose trading hours
+// began, several at once. Tickers that cannot start for want of a valid
+// enctoken are taken off the schedule, others are retried with a backoff and
+// taken off after repeated failures
+func (s *TickerService) startScheduled(ctx context.Context, now time.Time) {
+	tickers, err := s.repo.GetTickersByStatus(TickerStatusScheduled)
+	if err != nil {
+		slog.Error("Failed to get scheduled tickers", "error", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, scheduleStartWorkers)
+	due := make(map[string]bool)
+	var mu sync.Mutex
+	var results []scheduledStart
+
+	for _, ticker := range tickers {
+		userID, botID := ticker.UserID, ticker.BotID
+		key := fmt.Sprintf("%s:%s", userID, botID)
+
+		var opts TickerOptions
+		if err := json.Unmarshal([]byte(ticker.Options), &opts); err != nil || opts.Schedule == nil {
+			s.logTickerEvent(userID, botID, "ERROR", "Scheduler", "Invalid options of scheduled ticker, unscheduling")
+			if _, err := s.unscheduleTicker(userID, botID); err != nil {
+				s.logTickerEvent(userID, botID, "ERROR", "Scheduler", err.Error())
+			}
+			continue
+		}
+		tickerInstruments, err := s.repo.WithContext(ctx).GetTickerInstruments(botID, userID)
+		if err != nil {
+			s.logTickerEvent(userID, botID, "ERROR", "Scheduler", fmt.Sprintf("Failed to get instruments: %v", err))
+			continue
+		}
+
+		start, _, ok := s.scheduleWindow(opts.Schedule, tickerExchanges(tickerInstruments), now)
+		if !ok || now.Before(start) {
+			continue
+		}
+		due[key] = true
+		if retry, ok := s.scheduleRetries[key]; ok && now.Before(retry.next) {
+			continue
+		}
+
+		wg.Add(1)
+		workers <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			err := s.StartTicker(ctx, userID, "", botID, tickerInstruments, opts)
+			mu.Lock()
+			results = append(results, scheduledStart{userID: userID, botID: botID, err: err})
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	// Forget the retries of tickers no longer due
+	for key := range s.scheduleRetries {
+		if !due[key] {
+			delete(s.scheduleRetries, key)
+		}
+	}
+
+	for _, result := range results {
+		if result.err == nil {
+			delete(s.scheduleRetries, fmt.Sprintf("%s:%s", result.userID, result.botID))
+			continue
+		}
+		s.scheduleStartFailed(result.userID, result.botID, now, result.err)
+	}
+}
+
+// scheduleStartFailed handles a failed start of a scheduled ticker
+func (s *TickerService) scheduleStartFailed(userID, botID string, now time.Time, err error) {
+	key := fmt.Sprintf("%s:%s", userID, botID)
+
+	switch {
+	case errors.Is(err, ErrSessionExpired):
+		delete(s.scheduleRetries, key)
+		s.markSessionExpired(userID, botID)
+		return
+	case errors.Is(err, ErrNoCredential), errors.Is(err, ErrCredentialsDisabled):
+		delete(s.scheduleRetries, key)
+		s.logTickerEvent(userID, botID, "ERROR", "Scheduler", fmt.Sprintf("Failed to start scheduled ticker: %v", err))
+		if _, err := s.unscheduleTicker(userID, botID); err != nil {
+			s.logTickerEvent(userID, botID, "ERROR", "Scheduler", err.Error())
+		}
+		return
+	}
+
+	retry := s.scheduleRetries[key]
+	retry.failures++
+	if retry.failures >= scheduleMaxFailures {
+		delete(s.scheduleRetries, key)
+		s.logTickerEvent(userID, botID, "ERROR", "Scheduler", fmt.Sprintf("Failed to start scheduled ticker %d times, unscheduling: %v", retry.failures, err))
+		if _, err := s.unscheduleTicker(userID, botID); err != nil {
+			s.logTickerEvent(userID, botID, "ERROR", "Scheduler", err.Error())
+		}
+		return
+	}
+
+	backoff := min(scheduleCheckInterval<<(retry.failures-1), scheduleMaxBackoff)
+	retry.next = now.Add(backoff)
+	s.scheduleRetries[key] = retry
+	s.logTickerEvent(userID, botID, "WARN", "Scheduler", fmt.Sprintf("Failed to start scheduled ticker, retrying in %s: %v", backoff, err))
+}
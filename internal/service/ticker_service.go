@@ -1,80 +1,244 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/gorilla/websocket"
 	kiteticker "github.com/nsvirk/gokiteticker"
 	kitemodels "github.com/nsvirk/gokiteticker/models"
+	"github.com/nsvirk/moneybotstds/internal/config"
+	"github.com/nsvirk/moneybotstds/internal/greeks"
+	"github.com/nsvirk/moneybotstds/internal/kite"
 	"github.com/nsvirk/moneybotstds/internal/logger"
+	"github.com/nsvirk/moneybotstds/internal/market"
+	"github.com/nsvirk/moneybotstds/internal/metrics"
 	"github.com/nsvirk/moneybotstds/internal/models"
 	"github.com/nsvirk/moneybotstds/internal/repository"
+	"github.com/nsvirk/moneybotstds/internal/secrets"
+	"github.com/nsvirk/moneybotstds/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	"gorm.io/gorm"
 )
 
+// Ticker statuses stored in the tickers table
+const (
+	TickerStatusRunning        = "running"
+	TickerStatusStopped        = "stopped"
+	TickerStatusSessionExpired = "session_expired"
+	TickerStatusScheduled      = "scheduled"
+)
+
+// tickerConnectTimeout is how long StartTicker waits for the connection
+const tickerConnectTimeout = 10 * time.Second
+
 type TickerService struct {
-	db           *gorm.DB
-	redisClient  *repository.RedisClient
-	tickers      map[string]*TickerInstance
-	mu           sync.Mutex
-	tickerLogger *logger.TickerLogger
+	db              *gorm.DB
+	repo            *repository.Repository
+	redisClient     *repository.RedisClient
+	keyring         *secrets.Keyring
+	verifier        *kite.EnctokenVerifier
+	webhookService  *WebhookService
+	quotaService    *QuotaService
+	instrumentCache *InstrumentCache
+	calendar        *market.Calendar
+	tickers         map[string]*TickerInstance
+	starting        map[string]RunningTicker // tickers connecting, counted in the quotas
+	stopping        map[string]bool          // tickers removed and being closed
+	mu              sync.Mutex
+	tickerLogger    *logger.TickerLogger
+	riskFreeRate    float64
+
+	// Number of tickers, read without the lock by the health checks
+	running atomic.Int64
+
+	// Failed starts of scheduled tickers, only used by the scheduler
+	scheduleRetries map[string]scheduleRetry
+
+	// Tick latency above which instruments are flagged slow
+	latencyThreshold time.Duration
+
+	// Stale feed detection, see RunFeedWatchdog
+	feedInstrumentStaleAfter time.Duration
+	feedConnectionStaleAfter time.Duration
+	feedRecovery             string
 }
 
 type TickerInstance struct {
+	UserID   string
+	BotID    string
 	Ticker   *kiteticker.Ticker
 	TokenMap map[uint32]string
+	Enctoken string
+	Metrics  *metrics.TickerMetrics
+	Latency  *tickLatency
+	Feed     *feedWatch
+
+	// Exchanges of the instruments, and the trading hours schedule of
+	// scheduled tickers
+	Exchanges []string
+	Schedule  *Schedule
+
+	// Current session phase by exchange, only used by the ticker goroutine
+	phases map[string]market.Phase
+
+	// Receive time of the message being parsed, only used by the ticker
+	// goroutine
+	receivedAt time.Time
+
+	// Set while the enctoken is being checked after a failed handshake, and
+	// the time of the last check in unix nanoseconds
+	checkingSession  atomic.Bool
+	lastSessionCheck atomic.Int64
+
+	// Option greeks enrichment, only set when enabled for the ticker
+	Options     map[uint32]*optionContract
+	Underlyings map[uint32]string
+	LastPrices  map[uint32]float64
+
+	// Instrument metadata embedded in ticks, only set in MetadataEmbed mode
+	Metadata map[uint32]*InstrumentMetadata
+}
+
+// TickerOptions are the optional features of a ticker
+type TickerOptions struct {
+	EnrichGreeks bool
+	Metadata     string    // "", MetadataEmbed or MetadataChannel
+	Schedule     *Schedule `json:",omitempty"`
 }
 
+// Tick is a tick published to Redis. ExchangeTimestamp is the exchange
+// timestamp of the tick, zero if it has none, ReceivedAt is when the message
+// carrying it was received from Kite and PublishedAt is the time the tick was
+// handed to Redis.
+// SessionPhase is the phase of the exchange the tick belongs to, empty if the
+// sessions of the exchange are not known
 type Tick struct {
-	Exchange      string
-	TradingSymbol string
-	PublishedAt   time.Time
-	Tick          kitemodels.Tick
+	Exchange          string
+	TradingSymbol     string
+	ExchangeTimestamp time.Time
+	ReceivedAt        time.Time
+	PublishedAt       time.Time
+	SessionPhase      string `json:",omitempty"`
+	Tick              kitemodels.Tick
+	Greeks            *greeks.Greeks      `json:",omitempty"`
+	Metadata          *InstrumentMetadata `json:",omitempty"`
 }
 
-func NewTickerService(db *gorm.DB, redisClient *repository.RedisClient) *TickerService {
+// NewTickerService creates a new TickerService. keyring encrypts stored
+// enctokens, if nil enctokens are not stored and tickers cannot be resumed.
+// verifier detects expired sessions when the ticker cannot connect, and
+// webhookService is notified of the lifecycle events of tickers and
+// quotaService limits the tickers of each user. calendar knows the trading
+// hours scheduled tickers and the feed watchdog follow
+func NewTickerService(cfg *config.Config, db *gorm.DB, redisClient *repository.RedisClient, instrumentCache *InstrumentCache, keyring *secrets.Keyring, verifier *kite.EnctokenVerifier, webhookService *WebhookService, quotaService *QuotaService, calendar *market.Calendar) *TickerService {
 	return &TickerService{
-		db:           db,
-		redisClient:  redisClient,
-		tickers:      make(map[string]*TickerInstance),
-		tickerLogger: logger.NewTickerLogger(db),
+		db:              db,
+		repo:            repository.NewRepository(db),
+		redisClient:     redisClient,
+		keyring:         keyring,
+		verifier:        verifier,
+		webhookService:  webhookService,
+		quotaService:    quotaService,
+		instrumentCache: instrumentCache,
+		calendar:        calendar,
+		tickers:         make(map[string]*TickerInstance),
+		starting:        make(map[string]RunningTicker),
+		stopping:        make(map[string]bool),
+		scheduleRetries: make(map[string]scheduleRetry),
+		tickerLogger:    logger.NewTickerLogger(db),
+		riskFreeRate:    cfg.RiskFreeRate,
+
+		latencyThreshold: cfg.TickLatencyThreshold,
+
+		feedInstrumentStaleAfter: cfg.FeedInstrumentStaleAfter,
+		feedConnectionStaleAfter: cfg.FeedConnectionStaleAfter,
+		feedRecovery:             cfg.FeedRecovery,
 	}
 }
 
-func (s *TickerService) StartTicker(userID, enctoken, botID string, tickerInstruments []models.TickerInstrument) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// StartTicker starts publishing ticks of tickerInstruments for a bot. If
+// enctoken is empty the stored enctoken of the user is used, otherwise it is
+// stored for later resumes once the ticker started. Each phase is traced as a
+// child of the span in ctx. The ticker is connected without holding the lock,
+// its slot is reserved in the quota of the user meanwhile
+func (s *TickerService) StartTicker(ctx context.Context, userID, enctoken, botID string, tickerInstruments []models.TickerInstrument, opts TickerOptions) (err error) {
+	ctx, span := tracing.Start(ctx, "ticker.start",
+		attribute.String(logger.KeyUserID, userID),
+		attribute.String(logger.KeyBotID, botID),
+		attribute.Int("instruments", len(tickerInstruments)),
+	)
+	defer func() { tracing.End(span, err) }()
 
 	key := fmt.Sprintf("%s:%s", userID, botID)
 
-	// Check if user already has 3 active tickers
-	userTickerCount := 0
-	for k := range s.tickers {
-		if k[:len(userID)] == userID {
-			userTickerCount++
+	// Use the stored enctoken if none is given, a given one is stored once
+	// the ticker started
+	storeEnctoken := enctoken != ""
+	if enctoken == "" {
+		phaseCtx, phase := tracing.Start(ctx, "ticker.load_enctoken")
+		enctoken, err = s.loadEnctoken(phaseCtx, userID)
+		tracing.End(phase, err)
+		if err != nil {
+			return fmt.Errorf("failed to load enctoken: %w", err)
 		}
 	}
-	if userTickerCount >= 3 {
-		return fmt.Errorf("maximum tickers reached for user %s", userID)
+
+	// Reserve the bot and check the quota of the user
+	if err := s.reserveStart(userID, botID, len(tickerInstruments)); err != nil {
+		return err
 	}
+	defer s.releaseStart(key)
+
+	// Delete the series of the bot if it failed to start
+	defer func() {
+		if err != nil {
+			metrics.DeleteTickerMetrics(userID, botID)
+		}
+	}()
 
 	// Create new Kite ticker instance
 	ticker := kiteticker.New(userID, enctoken)
 
 	instance := &TickerInstance{
+		UserID:   userID,
+		BotID:    botID,
 		Ticker:   ticker,
 		TokenMap: make(map[uint32]string),
+		Enctoken: enctoken,
+		Metrics:  metrics.NewTickerMetrics(userID, botID),
+		Latency:  newTickLatency(s.latencyThreshold),
+		Feed:     newFeedWatch(),
+		Schedule: opts.Schedule,
+
+		Exchanges: tickerExchanges(tickerInstruments),
+		phases:    make(map[string]market.Phase),
 	}
 
-	// Set up callbacks
-	ticker.OnMessage(s.onMessage(userID, botID))
+	// Set up callbacks, signalling the connection attempts to StartTicker
+	connected := make(chan struct{}, 1)
+	handshakeFailed := make(chan struct{}, 1)
+
+	ticker.OnMessage(s.onMessage(userID, botID, instance))
 	ticker.OnTick(s.onTick(userID, botID, instance))
-	ticker.OnError(s.onError(userID, botID))
-	ticker.OnClose(s.onClose(userID, botID))
-	ticker.OnConnect(s.onConnect(userID, botID))
+	ticker.OnError(func(err error) {
+		s.onError(userID, botID, instance)(err)
+		if errors.Is(err, websocket.ErrBadHandshake) {
+			signal(handshakeFailed)
+		}
+	})
+	ticker.OnClose(s.onClose(userID, botID, instance))
+	ticker.OnConnect(func() {
+		s.onConnect(userID, botID, instance)()
+		signal(connected)
+	})
 	ticker.OnReconnect(s.onReconnect(userID, botID))
 	ticker.OnNoReconnect(s.onNoReconnect(userID, botID))
 
@@ -85,63 +249,211 @@ func (s *TickerService) StartTicker(userID, enctoken, botID string, tickerInstru
 		instance.TokenMap[inst.InstrumentToken] = fmt.Sprintf("%s:%s", inst.Exchange, inst.Tradingsymbol)
 	}
 
-	// Start the connection
-	go ticker.Serve()
+	// Load option contracts and subscribe to their underlying futures
+	if opts.EnrichGreeks {
+		_, phase := tracing.Start(ctx, "ticker.load_option_contracts")
+		contracts, underlyings, err := s.loadOptionContracts(userID, botID, tickerInstruments)
+		tracing.End(phase, err)
+		if err != nil {
+			return fmt.Errorf("failed to load option contracts: %w", err)
+		}
+		instance.Options = contracts
+		instance.Underlyings = underlyings
+		instance.LastPrices = make(map[uint32]float64)
+
+		for token := range underlyings {
+			if _, ok := instance.TokenMap[token]; !ok {
+				instTokens = append(instTokens, token)
+			}
+		}
+	}
 
-	// Wait for the connection to be established
-	connectionEstablished := make(chan bool)
-	ticker.OnConnect(func() {
-		s.onConnect(userID, botID)()
-		connectionEstablished <- true
-	})
+	// Load instrument metadata
+	var metadata map[uint32]*InstrumentMetadata
+	if opts.Metadata != "" {
+		_, phase := tracing.Start(ctx, "ticker.load_metadata")
+		metadata, err = s.loadInstrumentMetadata(tickerInstruments)
+		tracing.End(phase, err)
+		if err != nil {
+			return fmt.Errorf("failed to load instrument metadata: %w", err)
+		}
+		if opts.Metadata == MetadataEmbed {
+			instance.Metadata = metadata
+		}
+	}
+
+	// Start the connection and wait for it to be established
+	go ticker.Serve()
 
-	select {
-	case <-connectionEstablished:
-		fmt.Println("Connection established")
-	case <-time.After(10 * time.Second):
-		return fmt.Errorf("timed out waiting for ticker connection")
+	_, phase := tracing.Start(ctx, "ticker.connect")
+	err = s.waitForConnection(instance, connected, handshakeFailed)
+	tracing.End(phase, err)
+	if err != nil {
+		ticker.Stop()
+		return err
 	}
 
-	// Subscribe to instruments
-	if err := ticker.Subscribe(instTokens); err != nil {
-		return fmt.Errorf("subscription error: %w", err)
+	// Subscribe to instruments and set the subscription mode
+	_, phase = tracing.Start(ctx, "ticker.subscribe", attribute.Int("tokens", len(instTokens)))
+	err = s.subscribe(ticker, instTokens)
+	tracing.End(phase, err)
+	if err != nil {
+		ticker.Stop()
+		return err
 	}
+	s.publishEvent(userID, botID, subscriptionEvent(EventSubscribe, string(kiteticker.ModeFull), instTokens, instance))
 
-	// Set subscription mode
-	if err := ticker.SetMode(kiteticker.ModeFull, instTokens); err != nil {
-		return fmt.Errorf("setMode error: %w", err)
+	// Publish instrument metadata
+	if opts.Metadata == MetadataChannel {
+		if err := s.publishInstrumentMetadata(ctx, userID, botID, metadata); err != nil {
+			s.logTickerEvent(userID, botID, "ERROR", "StartTicker", fmt.Sprintf("Failed to publish instrument metadata: %v", err))
+		}
 	}
 
 	// Store ticker instance
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.starting, key)
 	s.tickers[key] = instance
+	s.countTickersLocked()
+	metrics.SubscribedInstruments.WithLabelValues(userID, botID).Set(float64(len(instTokens)))
+
+	// Record the ticker as running so it is resumed after a restart
+	if err := s.saveTickerState(ctx, userID, botID, TickerStatusRunning, opts); err != nil {
+		s.logTickerEvent(userID, botID, "ERROR", "StartTicker", fmt.Sprintf("Failed to store ticker state: %v", err))
+	}
+	if storeEnctoken {
+		if err := s.SaveCredential(userID, enctoken); err != nil && !errors.Is(err, ErrCredentialsDisabled) {
+			s.logTickerEvent(userID, botID, "ERROR", "StartTicker", fmt.Sprintf("Failed to store credential: %v", err))
+		}
+	}
 
 	// Log the event
 	s.logTickerEvent(userID, botID, "INFO", "StartTicker", "Ticker started successfully")
+	s.publishEvent(userID, botID, TickerEvent{Type: EventStarted, Message: "Ticker started"})
 
 	return nil
 }
 
-func (s *TickerService) StopTicker(userID, botID string) error {
+// reserveStart reserves a bot while its ticker starts, failing if the bot
+// has a running, starting or stopping ticker or the user is over quota, with
+// an error wrapping ErrTickerRunning or ErrQuotaExceeded
+func (s *TickerService) reserveStart(userID, botID string, instruments int) error {
+	quota, err := s.quotaService.GetQuota(userID)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkStartLocked(quota, userID, botID, instruments); err != nil {
+		return err
+	}
+	s.starting[fmt.Sprintf("%s:%s", userID, botID)] = RunningTicker{UserID: userID, BotID: botID, Instruments: instruments}
+	return nil
+}
+
+// CheckStart checks that a bot can start a ticker with instruments, before
+// its instruments are stored. It returns an error wrapping ErrTickerRunning or
+// ErrQuotaExceeded if not. StartTicker checks again
+func (s *TickerService) CheckStart(userID, botID string, instruments int) error {
+	quota, err := s.quotaService.GetQuota(userID)
+	if err != nil {
+		return err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.checkStartLocked(quota, userID, botID, instruments)
+}
 
+func (s *TickerService) checkStartLocked(quota Quota, userID, botID string, instruments int) error {
 	key := fmt.Sprintf("%s:%s", userID, botID)
+	if _, exists := s.tickers[key]; exists {
+		return fmt.Errorf("%w for user %s and bot %s", ErrTickerRunning, userID, botID)
+	}
+	if _, exists := s.starting[key]; exists {
+		return fmt.Errorf("%w for user %s and bot %s, it is starting", ErrTickerRunning, userID, botID)
+	}
+	if s.stopping[key] {
+		return fmt.Errorf("%w for user %s and bot %s, it is stopping", ErrTickerRunning, userID, botID)
+	}
+	bots, runningInstruments := s.usageLocked(userID)
+	return checkQuota(quota, bots, runningInstruments, instruments)
+}
 
+// releaseStart releases the reservation of a bot
+func (s *TickerService) releaseStart(key string) {
+	s.mu.Lock()
+	delete(s.starting, key)
+	s.mu.Unlock()
+}
+
+// subscribe subscribes a ticker to tokens in full mode
+func (s *TickerService) subscribe(ticker *kiteticker.Ticker, tokens []uint32) error {
+	if err := ticker.Subscribe(tokens); err != nil {
+		return fmt.Errorf("subscription error: %w", err)
+	}
+	if err := ticker.SetMode(kiteticker.ModeFull, tokens); err != nil {
+		return fmt.Errorf("setMode error: %w", err)
+	}
+	return nil
+}
+
+// StopTicker stops the running ticker of a bot, or unschedules it if it is
+// scheduled and waiting for the market to open
+func (s *TickerService) StopTicker(userID, botID string) error {
+	err := s.stopTicker(userID, botID, TickerStatusStopped, TickerEvent{Type: EventStopped, Message: "Ticker stopped"})
+	if errors.Is(err, ErrTickerNotRunning) {
+		if unscheduled, uerr := s.unscheduleTicker(userID, botID); uerr != nil || unscheduled {
+			return uerr
+		}
+	}
+	return err
+}
+
+// stopTicker stops the running ticker of a bot, recording it with status and
+// publishing event. The ticker is removed under the lock and closed after, the
+// bot cannot start again until it is recorded as stopped
+func (s *TickerService) stopTicker(userID, botID, status string, event TickerEvent) error {
+	key := fmt.Sprintf("%s:%s", userID, botID)
+
+	s.mu.Lock()
 	instance, exists := s.tickers[key]
 	if !exists {
-		return fmt.Errorf("ticker not found for user %s and bot %s", userID, botID)
+		s.mu.Unlock()
+		return fmt.Errorf("%w for user %s and bot %s", ErrTickerNotRunning, userID, botID)
 	}
+	delete(s.tickers, key)
+	s.stopping[key] = true
+	s.countTickersLocked()
+	metrics.DeleteTickerMetrics(userID, botID)
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.stopping, key)
+		s.mu.Unlock()
+	}()
 
 	// Unsubscribe from all tokens
 	var tokens []uint32
 	for token := range instance.TokenMap {
 		tokens = append(tokens, token)
 	}
+	for token := range instance.Underlyings {
+		if _, ok := instance.TokenMap[token]; !ok {
+			tokens = append(tokens, token)
+		}
+	}
 
 	if len(tokens) > 0 {
 		if err := instance.Ticker.Unsubscribe(tokens); err != nil {
 			s.logTickerEvent(userID, botID, "ERROR", "StopTicker", fmt.Sprintf("Failed to unsubscribe: %v", err))
 			// Continue with stopping even if unsubscribe fails
+		} else {
+			s.publishEvent(userID, botID, subscriptionEvent(EventUnsubscribe, "", tokens, instance))
 		}
 	}
 
@@ -153,20 +465,143 @@ func (s *TickerService) StopTicker(userID, botID string) error {
 		s.logTickerEvent(userID, botID, "ERROR", "StopTicker", fmt.Sprintf("Failed to close connection: %v", err))
 	}
 
-	// Remove the ticker instance from the map
-	delete(s.tickers, key)
+	// Record the ticker as stopped
+	now := time.Now()
+	if err := s.repo.UpdateTickerStatus(userID, botID, status, &now); err != nil {
+		s.logTickerEvent(userID, botID, "ERROR", "StopTicker", fmt.Sprintf("Failed to store ticker state: %v", err))
+	}
+
+	// Remove stored instrument metadata
+	if err := s.redisClient.Del(context.Background(), s.GetMetadataKey(userID, botID)); err != nil {
+		s.logTickerEvent(userID, botID, "ERROR", "StopTicker", fmt.Sprintf("Failed to delete instrument metadata: %v", err))
+	}
 
 	// Log the event
-	s.logTickerEvent(userID, botID, "INFO", "StopTicker", "Ticker stopped successfully")
+	s.logTickerEvent(userID, botID, "INFO", "StopTicker", event.Message)
+	s.publishEvent(userID, botID, event)
 
 	return nil
 }
 
+// RunningTicker is a ticker running in this service
+type RunningTicker struct {
+	UserID      string
+	BotID       string
+	Instruments int
+}
+
+// RunningTickers returns the tickers running in this service
+func (s *TickerService) RunningTickers() []RunningTicker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	running := make([]RunningTicker, 0, len(s.tickers))
+	for _, instance := range s.tickers {
+		running = append(running, RunningTicker{
+			UserID:      instance.UserID,
+			BotID:       instance.BotID,
+			Instruments: len(instance.TokenMap),
+		})
+	}
+	return running
+}
+
+// RunningCount returns the number of tickers running in this service without
+// waiting for the lock
+func (s *TickerService) RunningCount() int {
+	return int(s.running.Load())
+}
+
+// countTickersLocked updates the count of running tickers after s.tickers
+// changed
+func (s *TickerService) countTickersLocked() {
+	s.running.Store(int64(len(s.tickers)))
+	metrics.ActiveTickers.Set(float64(len(s.tickers)))
+}
+
+// StopUserTickers stops all running tickers of a user and unschedules the
+// scheduled ones, returning the IDs of the bots stopped
+func (s *TickerService) StopUserTickers(userID string) ([]string, error) {
+	s.mu.Lock()
+	var botIDs []string
+	for _, instance := range s.tickers {
+		if instance.UserID == userID {
+			botIDs = append(botIDs, instance.BotID)
+		}
+	}
+	s.mu.Unlock()
+
+	stopped := make([]string, 0, len(botIDs))
+	for _, botID := range botIDs {
+		if err := s.StopTicker(userID, botID); err != nil {
+			return stopped, err
+		}
+		stopped = append(stopped, botID)
+	}
+
+	scheduled, err := s.repo.GetTickersByStatus(TickerStatusScheduled)
+	if err != nil {
+		return stopped, fmt.Errorf("failed to get scheduled tickers: %w", err)
+	}
+	for _, ticker := range scheduled {
+		if ticker.UserID != userID {
+			continue
+		}
+		if _, err := s.unscheduleTicker(userID, ticker.BotID); err != nil {
+			return stopped, err
+		}
+		stopped = append(stopped, ticker.BotID)
+	}
+	return stopped, nil
+}
+
+// ListTickers returns the stored state of all tickers, with a status if set
+func (s *TickerService) ListTickers(status string) ([]models.Ticker, error) {
+	return s.repo.GetTickers(status)
+}
+
+// Usage returns the number of running bots of a user and the instruments
+// they publish
+func (s *TickerService) Usage(userID string) (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usageLocked(userID)
+}
+
+func (s *TickerService) usageLocked(userID string) (int, int) {
+	bots, instruments := 0, 0
+	for _, instance := range s.tickers {
+		if instance.UserID == userID {
+			bots++
+			instruments += len(instance.TokenMap)
+		}
+	}
+	for _, starting := range s.starting {
+		if starting.UserID == userID {
+			bots++
+			instruments += starting.Instruments
+		}
+	}
+	return bots, instruments
+}
+
 func (s *TickerService) onTick(userID, botID string, instance *TickerInstance) func(tick kitemodels.Tick) {
 	return func(tick kitemodels.Tick) {
+		instance.Metrics.TicksReceived.Inc()
+		instance.Feed.tick(tick.InstrumentToken, instance.receivedAt)
+
+		// Track prices for option greeks
+		if instance.LastPrices != nil {
+			instance.LastPrices[tick.InstrumentToken] = tick.LastPrice
+		}
+
 		// Get exchange and tradingsymbol
 		instrument, ok := instance.TokenMap[tick.InstrumentToken]
 		if !ok {
+			// Underlying futures subscribed only for greeks are not published
+			if _, ok := instance.Underlyings[tick.InstrumentToken]; ok {
+				return
+			}
 			s.logTickerEvent(userID, botID, "ERROR", "onTick", fmt.Sprintf("Unknown instrument token: %d", tick.InstrumentToken))
 			return
 		}
@@ -182,51 +617,96 @@ func (s *TickerService) onTick(userID, botID string, instance *TickerInstance) f
 
 		// For new Tick
 		newTick := Tick{
-			Exchange:      exchange,
-			TradingSymbol: tradingSymbol,
-			PublishedAt:   time.Now(),
-			Tick:          tick,
+			Exchange:          exchange,
+			TradingSymbol:     tradingSymbol,
+			ExchangeTimestamp: tick.Timestamp.Time,
+			ReceivedAt:        instance.receivedAt,
+			PublishedAt:       time.Now(),
+			SessionPhase:      s.sessionPhase(instance, exchange, tick.Timestamp.Time),
+			Tick:              tick,
+			Greeks:            s.computeGreeks(instance, tick),
+			Metadata:          instance.Metadata[tick.InstrumentToken],
 		}
 
 		tickJSON, err := json.Marshal(newTick)
 		if err != nil {
+			instance.Metrics.PublishErrors.Inc()
 			s.logTickerEvent(userID, botID, "ERROR", "onTick", fmt.Sprintf("Failed to marshal tick: %v", err))
 			return
 		}
 
-		// Publish tick to Redis channel
+		// Publish tick to Redis channel, a sample of the ticks is traced
+		ctx, span := tracing.Start(context.Background(), tracing.TickSpanName,
+			attribute.String(logger.KeyUserID, userID),
+			attribute.String(logger.KeyBotID, botID),
+			attribute.String("instrument", instrument),
+		)
 		channelName := fmt.Sprintf("CH:TICKS:%s:%s", userID, botID)
-		if err := s.redisClient.PublishTicks(channelName, tickJSON); err != nil {
+		publishStart := time.Now()
+		err = s.redisClient.PublishTicks(ctx, channelName, tickJSON)
+		publishedAt := time.Now()
+		metrics.RedisPublishSeconds.Observe(publishedAt.Sub(publishStart).Seconds())
+		tracing.End(span, err)
+		if err != nil {
+			instance.Metrics.PublishErrors.Inc()
 			s.logTickerEvent(userID, botID, "ERROR", "PublishTicks", fmt.Sprintf("Failed to publish tick: %v", err))
+			return
+		}
+
+		instance.Metrics.TicksPublished.Inc()
+		if !tick.Timestamp.IsZero() {
+			metrics.TickAgeSeconds.WithLabelValues(exchange).Observe(publishedAt.Sub(tick.Timestamp.Time).Seconds())
 		}
+		s.recordLatency(userID, botID, instance, tick.InstrumentToken, newTick, publishedAt)
 	}
 }
 
-func (s *TickerService) onError(userID, botID string) func(err error) {
+func (s *TickerService) onError(userID, botID string, instance *TickerInstance) func(err error) {
 	return func(err error) {
 		s.logTickerEvent(userID, botID, "ERROR", "onError", err.Error())
+		s.publishEvent(userID, botID, TickerEvent{Type: EventError, Message: err.Error()})
+
+		// Kite rejects the handshake of an expired session
+		if errors.Is(err, websocket.ErrBadHandshake) {
+			go s.checkSession(userID, botID, instance)
+		}
 	}
 }
 
-func (s *TickerService) onClose(userID, botID string) func(code int, reason string) {
+func (s *TickerService) onClose(userID, botID string, instance *TickerInstance) func(code int, reason string) {
 	return func(code int, reason string) {
 		s.logTickerEvent(userID, botID, "INFO", "onClose", fmt.Sprintf("Connection closed: code=%d, reason=%s", code, reason))
+		s.publishEvent(userID, botID, TickerEvent{Type: EventClose, Code: code, Reason: reason})
+
+		if code != websocket.CloseNormalClosure {
+			go s.checkSession(userID, botID, instance)
+		}
 	}
 }
 
-func (s *TickerService) onConnect(userID, botID string) func() {
+func (s *TickerService) onConnect(userID, botID string, instance *TickerInstance) func() {
 	return func() {
+		instance.Feed.connected(time.Now())
 		s.logTickerEvent(userID, botID, "INFO", "onConnect", "Connected to Kite ticker")
+		s.publishEvent(userID, botID, TickerEvent{Type: EventConnect, Message: "Connected to Kite ticker"})
 	}
 }
 
 func (s *TickerService) onReconnect(userID, botID string) func(attempt int, delay time.Duration) {
 	return func(attempt int, delay time.Duration) {
 		s.logTickerEvent(userID, botID, "INFO", "onReconnect", fmt.Sprintf("Reconnected to Kite ticker after %d attempts, delay: %v", attempt, delay))
+		s.publishEvent(userID, botID, TickerEvent{Type: EventReconnect, Attempt: attempt, DelayMs: delay.Milliseconds()})
+		metrics.Reconnects.WithLabelValues(userID, botID).Inc()
 	}
 }
-func (s *TickerService) onMessage(userID, botID string) func(messageType int, message []byte) {
+
+// onMessage is called for each message before its ticks are parsed, the
+// receive time of binary messages is stamped on their ticks
+func (s *TickerService) onMessage(userID, botID string, instance *TickerInstance) func(messageType int, message []byte) {
 	return func(messageType int, message []byte) {
+		if messageType == websocket.BinaryMessage {
+			instance.receivedAt = time.Now()
+		}
 		if messageType == 1 {
 			s.logTickerEvent(userID, botID, "INFO", "onMessage", fmt.Sprintf("Received message: type=%d, message=%s", messageType, string(message)))
 		}
@@ -236,6 +716,7 @@ func (s *TickerService) onMessage(userID, botID string) func(messageType int, me
 func (s *TickerService) onNoReconnect(userID, botID string) func(attempt int) {
 	return func(attempt int) {
 		s.logTickerEvent(userID, botID, "INFO", "onNoReconnect", fmt.Sprintf("No reconnect after %d attempts", attempt))
+		s.publishEvent(userID, botID, TickerEvent{Type: EventNoReconnect, Attempt: attempt})
 	}
 }
 
@@ -243,6 +724,70 @@ func (s *TickerService) logTickerEvent(userID, botID, level, eventType, message
 	s.tickerLogger.Log(userID, botID, level, eventType, message)
 }
 
+// ResumeTickers starts the tickers that were running when the service last
+// stopped, using the stored enctokens of their users
+func (s *TickerService) ResumeTickers() {
+	tickers, err := s.repo.GetTickersByStatus(TickerStatusRunning)
+	if err != nil {
+		slog.Error("Failed to get tickers to resume", "error", err)
+		return
+	}
+
+	for _, ticker := range tickers {
+		_, err := s.resumeTicker(context.Background(), ticker, "")
+		if errors.Is(err, ErrSessionExpired) {
+			s.markSessionExpired(ticker.UserID, ticker.BotID)
+			continue
+		}
+		if err != nil {
+			s.logTickerEvent(ticker.UserID, ticker.BotID, "ERROR", "ResumeTicker", fmt.Sprintf("Failed to resume ticker: %v", err))
+		}
+	}
+}
+
+// resumeTicker starts a stored ticker with its instruments and options. A
+// scheduled ticker outside its trading hours is scheduled instead, and the
+// time it starts is returned
+func (s *TickerService) resumeTicker(ctx context.Context, ticker models.Ticker, enctoken string) (time.Time, error) {
+	var opts TickerOptions
+	if ticker.Options != "" {
+		if err := json.Unmarshal([]byte(ticker.Options), &opts); err != nil {
+			return time.Time{}, fmt.Errorf("invalid ticker options: %w", err)
+		}
+	}
+
+	tickerInstruments, err := s.repo.WithContext(ctx).GetTickerInstruments(ticker.BotID, ticker.UserID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get instruments: %w", err)
+	}
+
+	if opts.Schedule != nil {
+		return s.ScheduleTicker(ctx, ticker.UserID, enctoken, ticker.BotID, tickerInstruments, opts)
+	}
+	if err := s.StartTicker(ctx, ticker.UserID, enctoken, ticker.BotID, tickerInstruments, opts); err != nil {
+		return time.Time{}, err
+	}
+
+	s.logTickerEvent(ticker.UserID, ticker.BotID, "INFO", "ResumeTicker", "Ticker resumed")
+	return time.Time{}, nil
+}
+
+// saveTickerState records the status of a ticker with its options
+func (s *TickerService) saveTickerState(ctx context.Context, userID, botID, status string, opts TickerOptions) error {
+	optsJSON, err := json.Marshal(opts)
+	if err != nil {
+		return fmt.Errorf("failed to marshal options: %w", err)
+	}
+
+	return s.repo.WithContext(ctx).UpsertTicker(&models.Ticker{
+		UserID:    userID,
+		BotID:     botID,
+		Status:    status,
+		Options:   string(optsJSON),
+		StartedAt: time.Now(),
+	})
+}
+
 func (s *TickerService) Close() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nsvirk/moneybotstds/internal/kite"
+	"github.com/nsvirk/moneybotstds/internal/metrics"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrSessionExpired is returned when Kite rejects the enctoken of a ticker
+	ErrSessionExpired = errors.New("kite session expired")
+	// ErrTickerNotFound is returned when a bot has no stored ticker
+	ErrTickerNotFound = errors.New("ticker not found")
+	// ErrTickerNotExpired is returned when resuming a ticker whose session did
+	// not expire
+	ErrTickerNotExpired = errors.New("ticker session has not expired")
+)
+
+// ControlSessionExpired is the control message published when the session of a
+// ticker expires
+const ControlSessionExpired = "session_expired"
+
+// ControlMessage is published on the ticks channel of a bot when the ticker
+// changes state on its own. Consumers tell it apart from a Tick by `Control`
+type ControlMessage struct {
+	Control     string
+	UserID      string
+	BotID       string
+	Message     string
+	PublishedAt time.Time
+}
+
+// ResumeTicker restarts a ticker stopped by an expired session with the same
+// instruments and options. If enctoken is empty the stored enctoken is used.
+// A scheduled ticker outside its trading hours is scheduled again and the
+// time it starts is returned
+func (s *TickerService) ResumeTicker(ctx context.Context, userID, enctoken, botID string) (time.Time, error) {
+	ticker, err := s.repo.WithContext(ctx).GetTicker(userID, botID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, ErrTickerNotFound
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get ticker: %w", err)
+	}
+
+	if ticker.Status != TickerStatusSessionExpired {
+		return time.Time{}, ErrTickerNotExpired
+	}
+
+	return s.resumeTicker(ctx, *ticker, enctoken)
+}
+
+// waitForConnection waits for the first connection of a ticker. A failed
+// handshake fails fast with ErrSessionExpired if Kite rejects the enctoken,
+// otherwise the ticker keeps retrying until the timeout
+func (s *TickerService) waitForConnection(instance *TickerInstance, connected, handshakeFailed <-chan struct{}) error {
+	timeout := time.After(tickerConnectTimeout)
+	for {
+		select {
+		case <-connected:
+			return nil
+		case <-handshakeFailed:
+			if s.isSessionExpired(instance.Enctoken) {
+				return ErrSessionExpired
+			}
+		case <-timeout:
+			return fmt.Errorf("timed out waiting for ticker connection")
+		}
+	}
+}
+
+// checkSession stops a running ticker if Kite no longer accepts its enctoken.
+// It is called when the connection fails, one check at a time per ticker and
+// at most once per negative cache TTL of the verifier
+func (s *TickerService) checkSession(userID, botID string, instance *TickerInstance) {
+	if !s.isRunning(userID, botID, instance) {
+		return
+	}
+
+	if !instance.checkingSession.CompareAndSwap(false, true) {
+		return
+	}
+	defer instance.checkingSession.Store(false)
+
+	now := time.Now()
+	if last := instance.lastSessionCheck.Load(); last != 0 && now.Sub(time.Unix(0, last)) < s.verifier.NegativeTTL() {
+		return
+	}
+	instance.lastSessionCheck.Store(now.UnixNano())
+
+	if !s.isSessionExpired(instance.Enctoken) {
+		return
+	}
+
+	s.mu.Lock()
+	if !s.isRunningLocked(userID, botID, instance) {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.tickers, fmt.Sprintf("%s:%s", userID, botID))
+	s.countTickersLocked()
+	metrics.DeleteTickerMetrics(userID, botID)
+	s.mu.Unlock()
+
+	// The connection already failed, stopping ends the serve loop of the
+	// ticker, which closes it
+	instance.Ticker.SetAutoReconnect(false)
+	instance.Ticker.Stop()
+
+	s.markSessionExpired(userID, botID)
+}
+
+// markSessionExpired records a ticker as stopped by an expired session and
+// tells the consumers of the bot
+func (s *TickerService) markSessionExpired(userID, botID string) {
+	now := time.Now()
+	if err := s.repo.UpdateTickerStatus(userID, botID, TickerStatusSessionExpired, &now); err != nil {
+		s.logTickerEvent(userID, botID, "ERROR", "SessionExpired", fmt.Sprintf("Failed to store ticker state: %v", err))
+	}
+
+	if err := s.redisClient.Del(context.Background(), s.GetMetadataKey(userID, botID)); err != nil {
+		s.logTickerEvent(userID, botID, "ERROR", "SessionExpired", fmt.Sprintf("Failed to delete instrument metadata: %v", err))
+	}
+
+	message := "Kite session expired, resume the ticker with a fresh enctoken"
+	if err := s.publishControl(userID, botID, ControlSessionExpired, message); err != nil {
+		s.logTickerEvent(userID, botID, "ERROR", "SessionExpired", fmt.Sprintf("Failed to publish control message: %v", err))
+	}
+
+	s.logTickerEvent(userID, botID, "WARN", "SessionExpired", "Ticker stopped, Kite session expired")
+	s.publishEvent(userID, botID, TickerEvent{Type: EventSessionExpired, Message: message})
+}
+
+// publishControl publishes a control message on the ticks channel of a bot
+func (s *TickerService) publishControl(userID, botID, control, message string) error {
+	controlJSON, err := json.Marshal(ControlMessage{
+		Control:     control,
+		UserID:      userID,
+		BotID:       botID,
+		Message:     message,
+		PublishedAt: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal control message: %w", err)
+	}
+
+	return s.redisClient.Publish(context.Background(), s.GetTicksChannel(userID, botID), controlJSON)
+}
+
+// isSessionExpired checks the enctoken with Kite, bypassing the verifier cache
+func (s *TickerService) isSessionExpired(enctoken string) bool {
+	_, err := s.verifier.Recheck(context.Background(), enctoken)
+	return errors.Is(err, kite.ErrInvalidSession)
+}
+
+// isRunning reports whether instance is the running ticker of the bot
+func (s *TickerService) isRunning(userID, botID string, instance *TickerInstance) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.isRunningLocked(userID, botID, instance)
+}
+
+func (s *TickerService) isRunningLocked(userID, botID string, instance *TickerInstance) bool {
+	return s.tickers[fmt.Sprintf("%s:%s", userID, botID)] == instance
+}
+
+// signal notifies ch without blocking if a notification is already pending
+func signal(ch chan<- struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
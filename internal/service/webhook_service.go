@@ -0,0 +1,399 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nsvirk/moneybotstds/internal/logger"
+	"github.com/nsvirk/moneybotstds/internal/models"
+	"github.com/nsvirk/moneybotstds/internal/repository"
+	"gorm.io/gorm"
+)
+
+// WebhookEvents are the ticker events webhooks can be notified of
+var WebhookEvents = []string{EventStarted, EventStopped, EventClose, EventNoReconnect, EventSessionExpired, EventScheduled}
+
+var (
+	// ErrWebhookNotFound is returned when a user has no webhook with an ID
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrInvalidWebhook is returned when a webhook cannot be created as given
+	ErrInvalidWebhook = errors.New("invalid webhook")
+	// errWebhookAddress is returned when a webhook resolves to an address
+	// deliveries are not sent to
+	errWebhookAddress = errors.New("webhook address is not public")
+)
+
+// Webhook delivery settings. A delivery is attempted up to
+// webhookMaxAttempts times, waiting webhookRetryDelay doubled after each
+// failed attempt
+const (
+	webhookTimeout     = 10 * time.Second
+	webhookMaxAttempts = 5
+	webhookRetryDelay  = 2 * time.Second
+)
+
+// Events are delivered by webhookWorkers workers from a queue of
+// webhookQueueSize events, events are dropped while the queue is full
+const (
+	webhookWorkers   = 8
+	webhookQueueSize = 1000
+)
+
+// webhookResolveTimeout bounds the lookup of the host of a new webhook
+const webhookResolveTimeout = 5 * time.Second
+
+// WebhookService stores webhooks and delivers ticker events to them
+type WebhookService struct {
+	repo      *repository.Repository
+	client    *http.Client
+	appLogger *logger.AppLogger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// mu guards sends on events against Close
+	mu     sync.Mutex
+	events chan TickerEvent
+	closed bool
+}
+
+// NewWebhookService creates a new WebhookService and starts its delivery
+// workers
+func NewWebhookService(db *gorm.DB) *WebhookService {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &WebhookService{
+		repo:      repository.NewRepository(db),
+		client:    newWebhookClient(),
+		appLogger: logger.NewAppLogger(db),
+		ctx:       ctx,
+		cancel:    cancel,
+		events:    make(chan TickerEvent, webhookQueueSize),
+	}
+
+	for range webhookWorkers {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			for event := range s.events {
+				s.notify(event)
+			}
+		}()
+	}
+	return s
+}
+
+// newWebhookClient returns a client that only connects to public addresses,
+// checked on every dial so redirects and DNS changes cannot reach internal
+// hosts. Proxies are not used, they would be dialed instead of the webhook
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublicAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", errWebhookAddress, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: webhookTimeout, Transport: transport}
+}
+
+// isPublicAddr reports whether deliveries may be sent to an address, i.e. it
+// is not loopback, private, link-local, shared, multicast or unspecified
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() &&
+		!addr.IsLoopback() &&
+		!addr.IsPrivate() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast() &&
+		!addr.IsUnspecified() &&
+		!sharedAddressSpace.Contains(addr)
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, internal to providers
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// checkWebhookHost resolves the host of a webhook and checks that all its
+// addresses are public
+func checkWebhookHost(host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !isPublicAddr(addr) {
+			return errWebhookAddress
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookResolveTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s", host)
+	}
+	for _, addr := range addrs {
+		if !isPublicAddr(addr) {
+			return errWebhookAddress
+		}
+	}
+	return nil
+}
+
+// CreateWebhook registers a webhook for all bots of the user, or for botID if
+// set, notified of events, all WebhookEvents if none are given. The secret
+// signing the payloads is returned with the webhook
+func (s *WebhookService) CreateWebhook(userID, botID, rawURL string, events []string) (*models.Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return nil, fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	if err := checkWebhookHost(u.Hostname()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+
+	if len(events) == 0 {
+		events = WebhookEvents
+	}
+	for _, event := range events {
+		if !slices.Contains(WebhookEvents, event) {
+			return nil, fmt.Errorf("%w: unknown event: %s", ErrInvalidWebhook, event)
+		}
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook := &models.Webhook{
+		UserID:    userID,
+		BotID:     botID,
+		URL:       rawURL,
+		Secret:    secret,
+		Events:    strings.Join(events, ","),
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.InsertWebhook(webhook); err != nil {
+		return nil, fmt.Errorf("failed to store webhook: %w", err)
+	}
+
+	return webhook, nil
+}
+
+// ListWebhooks lists the webhooks of the user
+func (s *WebhookService) ListWebhooks(userID string) ([]models.Webhook, error) {
+	return s.repo.GetWebhooks(userID)
+}
+
+// DeleteWebhook deletes a webhook of the user
+func (s *WebhookService) DeleteWebhook(userID string, id uint32) error {
+	deleted, err := s.repo.DeleteWebhook(userID, id)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// ListDeliveries lists the latest delivery attempts of a webhook of the user
+func (s *WebhookService) ListDeliveries(userID string, id uint32, limit int) ([]models.WebhookDelivery, error) {
+	if _, err := s.repo.GetWebhook(userID, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	return s.repo.GetWebhookDeliveries(id, limit)
+}
+
+// Notify queues a ticker event for delivery to the webhooks of its bot. The
+// event is dropped if the queue is full
+func (s *WebhookService) Notify(event TickerEvent) {
+	if !slices.Contains(WebhookEvents, event.Type) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.events <- event:
+	default:
+		s.appLogger.Warn("Webhook queue full, dropped event", "event", event.Type, logger.KeyUserID, event.UserID, logger.KeyBotID, event.BotID)
+	}
+}
+
+// notify delivers an event to the webhooks of its bot, one after another
+func (s *WebhookService) notify(event TickerEvent) {
+	if s.ctx.Err() != nil {
+		return
+	}
+
+	webhooks, err := s.repo.GetBotWebhooks(event.UserID, event.BotID)
+	if err != nil {
+		s.appLogger.Error("Failed to get webhooks", logger.KeyUserID, event.UserID, logger.KeyBotID, event.BotID, "error", err)
+		return
+	}
+
+	var payload []byte
+	for _, webhook := range webhooks {
+		if !slices.Contains(WebhookEventsOf(&webhook), event.Type) {
+			continue
+		}
+
+		if payload == nil {
+			if payload, err = json.Marshal(event); err != nil {
+				s.appLogger.Error("Failed to marshal webhook payload", "error", err)
+				return
+			}
+		}
+
+		deliveryID, err := randomHex(16)
+		if err != nil {
+			s.appLogger.Error("Failed to create webhook delivery id", "error", err)
+			return
+		}
+
+		s.deliver(webhook, deliveryID, event, payload)
+		if s.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// Close stops queueing events, cancels the deliveries in flight and waits
+// for the workers to return. Queued events are not delivered
+func (s *WebhookService) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.events)
+	s.mu.Unlock()
+
+	s.cancel()
+	s.wg.Wait()
+}
+
+// deliver posts the payload to a webhook, retrying with backoff until it is
+// accepted or the attempts run out. Every attempt is recorded
+func (s *WebhookService) deliver(webhook models.Webhook, deliveryID string, event TickerEvent, payload []byte) {
+	delay := webhookRetryDelay
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		start := time.Now()
+		statusCode, err := s.post(webhook, deliveryID, event.Type, payload)
+
+		delivery := models.WebhookDelivery{
+			WebhookID:   webhook.ID,
+			DeliveryID:  deliveryID,
+			BotID:       event.BotID,
+			Event:       event.Type,
+			Payload:     string(payload),
+			Attempt:     attempt,
+			StatusCode:  statusCode,
+			Success:     err == nil,
+			DurationMs:  time.Since(start).Milliseconds(),
+			AttemptedAt: start,
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		if err := s.repo.InsertWebhookDelivery(&delivery); err != nil {
+			s.appLogger.Error("Failed to store webhook delivery", "delivery_id", deliveryID, "error", err)
+		}
+
+		if delivery.Success {
+			return
+		}
+
+		if attempt < webhookMaxAttempts {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+	}
+
+	s.appLogger.Warn("Webhook gave up delivering event", "webhook_id", webhook.ID, "event", event.Type, "delivery_id", deliveryID)
+}
+
+// post sends one delivery attempt. Any 2xx response accepts the delivery
+func (s *WebhookService) post(webhook models.Webhook, deliveryID, eventType string, payload []byte) (int, error) {
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-MB-Event", eventType)
+	req.Header.Set("X-MB-Delivery", deliveryID)
+	req.Header.Set("X-MB-Timestamp", timestamp)
+	req.Header.Set("X-MB-Signature", "sha256="+SignWebhookPayload(webhook.Secret, timestamp, payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhookPayload returns the hex HMAC-SHA256 of `<timestamp>.<payload>`
+// with the webhook secret
+func SignWebhookPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookEventsOf returns the events a webhook is notified of
+func WebhookEventsOf(webhook *models.Webhook) []string {
+	if webhook.Events == "" {
+		return nil
+	}
+	return strings.Split(webhook.Events, ",")
+}
@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/redis/go-redis/v9"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RedisHook traces the commands run with a context that has a recording span
+type RedisHook struct{}
+
+// NewRedisHook creates a new RedisHook
+func NewRedisHook() *RedisHook {
+	return &RedisHook{}
+}
+
+func (h *RedisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h *RedisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, span, ok := StartChild(ctx, "redis."+cmd.Name(), trace.SpanKindClient,
+			semconv.DBSystemRedis,
+			semconv.DBOperationName(cmd.Name()),
+		)
+		if !ok {
+			return next(ctx, cmd)
+		}
+
+		// A missing key is not an error of the span, but is returned as is
+		err := next(ctx, cmd)
+		spanErr := err
+		if errors.Is(err, redis.Nil) {
+			spanErr = nil
+		}
+		End(span, spanErr)
+		return err
+	}
+}
+
+func (h *RedisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, span, ok := StartChild(ctx, "redis.pipeline", trace.SpanKindClient, semconv.DBSystemRedis)
+		if !ok {
+			return next(ctx, cmds)
+		}
+
+		err := next(ctx, cmds)
+		End(span, err)
+		return err
+	}
+}
@@ -0,0 +1,126 @@
+// Package tracing sets up OpenTelemetry tracing of HTTP requests, database
+// queries, Redis commands and the phases of starting tickers
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/nsvirk/moneybotstds/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters of the spans
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// TickSpanName is the name of the root span of a tick, sampled at the tick
+// sample ratio as ticks are far more frequent than requests
+const TickSpanName = "ticker.tick"
+
+const instrumentationName = "github.com/nsvirk/moneybotstds"
+
+// Setup installs the tracer provider of the configured exporter. Without an
+// exporter tracing is disabled and spans are not recorded. The returned
+// function flushes the spans and must be called on shutdown
+func Setup(ctx context.Context, cfg *config.Config) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch cfg.TracingExporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if cfg.TracingEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.TracingEndpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("invalid tracing exporter: %s, must be otlp or stdout", cfg.TracingExporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(newSampler(cfg.TracingSampleRatio, cfg.TracingTickSampleRatio)),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName("moneybotstds"),
+			semconv.ServiceVersion(cfg.AppVersion),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// Start starts a span as a child of the span in ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartServer starts the span of a request served by the service
+func StartServer(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+}
+
+// StartChild starts a span only if ctx has a recording span, so queries and
+// commands outside of traced work do not start traces of their own
+func StartChild(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span, bool) {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return ctx, nil, false
+	}
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+	return ctx, span, true
+}
+
+// End records err on span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// newSampler samples root spans of ticks at tickRatio and other root spans at
+// ratio. Child spans are sampled with their parent
+func newSampler(ratio, tickRatio float64) sdktrace.Sampler {
+	return sdktrace.ParentBased(rootSampler{
+		requests: sdktrace.TraceIDRatioBased(ratio),
+		ticks:    sdktrace.TraceIDRatioBased(tickRatio),
+	})
+}
+
+type rootSampler struct {
+	requests sdktrace.Sampler
+	ticks    sdktrace.Sampler
+}
+
+func (s rootSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if p.Name == TickSpanName {
+		return s.ticks.ShouldSample(p)
+	}
+	return s.requests.ShouldSample(p)
+}
+
+func (s rootSampler) Description() string {
+	return fmt.Sprintf("RootSampler{requests:%s,ticks:%s}", s.requests.Description(), s.ticks.Description())
+}
@@ -32,8 +32,10 @@ func SuccessResponse(c echo.Context, data interface{}) error {
 	})
 }
 
-// ErrorResponse sends an error JSON response
+// ErrorResponse sends an error JSON response. The error is also set in the
+// context as `errorMessage` for middleware
 func ErrorResponse(c echo.Context, httpStatus int, errorType, message string) error {
+	c.Set("errorMessage", errorType+": "+message)
 	return c.JSON(httpStatus, Response{
 		Status:    "error",
 		ErrorType: errorType,